@@ -1,8 +1,21 @@
 module github.com/solo-io/go-list-licenses
 
-go 1.15
+go 1.18
 
 require (
+	github.com/pkg/errors v0.9.1
 	github.com/solo-io/go-utils v0.20.2
 	github.com/spf13/cobra v1.1.1
+	golang.org/x/mod v0.20.0
+)
+
+require (
+	github.com/ghodss/yaml v1.0.0 // indirect
+	github.com/gogo/protobuf v1.3.1 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.0.0 // indirect
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/rotisserie/eris v0.1.1 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
@@ -0,0 +1,145 @@
+package license
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// listBinaryLicenses returns the licenses of the modules linked into the
+// supplied executables, as recorded in their embedded build information, and
+// the binaries built with each Go version.
+func listBinaryLicenses(binaries []string, lo loadOptions) ([]License, map[string][]string, error) {
+	infos, goVersions, err := listBinaryDependencies(binaries, lo)
+	if err != nil {
+		return nil, nil, err
+	}
+	licenses, err := matchLicenses(infos, lo)
+	return licenses, goVersions, err
+}
+
+// listBinaryDependencies reads the module list embedded in each binary and
+// resolves every module@version to its directory in the module cache. Modules
+// missing from the cache are returned with an error instead of failing the
+// whole listing. Each entry carries the binaries it is linked into. The
+// binaries are also returned by the Go version they were built with.
+func listBinaryDependencies(binaries []string, lo loadOptions) ([]*PkgInfo, map[string][]string, error) {
+	modCache, err := goModCache(lo)
+	if err != nil {
+		return nil, nil, err
+	}
+	var depInfos []*PkgInfo
+	byKey := map[string]*PkgInfo{}
+	goVersions := map[string][]string{}
+	for _, binary := range binaries {
+		bi, err := buildinfo.ReadFile(binary)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to read build info of %s", binary)
+		}
+		goVersions[bi.GoVersion] = append(goVersions[bi.GoVersion], binary)
+		for _, dep := range bi.Deps {
+			key := dep.Path + "@" + dep.Version
+			depInfo := byKey[key]
+			if depInfo == nil {
+				depInfo = &PkgInfo{
+					Name:       dep.Path,
+					ImportPath: dep.Path,
+					Version:    dep.Version,
+					// modules of a binary are linked into it
+					Category: CategoryRuntime,
+				}
+				mod := dep
+				if dep.Replace != nil {
+					mod = dep.Replace
+					depInfo.ReplacePath = mod.Path
+					depInfo.ReplaceVersion = mod.Version
+				}
+				depInfo.Sum = mod.Sum
+				dir, err := moduleCacheDir(modCache, mod.Path, mod.Version)
+				if err != nil {
+					depInfo.Error = &PkgError{Err: err.Error()}
+				} else {
+					depInfo.Dir = dir
+					depInfo.Root = dir
+				}
+				byKey[key] = depInfo
+				depInfos = append(depInfos, depInfo)
+			}
+			depInfo.UsedBy = mergeStrings(depInfo.UsedBy, []string{binary})
+		}
+	}
+	sort.Slice(depInfos, func(i, j int) bool {
+		return depInfos[i].ImportPath < depInfos[j].ImportPath
+	})
+	return depInfos, goVersions, nil
+}
+
+// goModCache returns the module cache directory used by the go command.
+func goModCache(lo loadOptions) (string, error) {
+	values, err := lo.goEnv("GOMODCACHE")
+	if err != nil {
+		return "", errors.Wrap(err, "unable to locate the module cache")
+	}
+	return values[0], nil
+}
+
+// moduleCacheDir returns the directory of module path@version in the module
+// cache rooted at modCache.
+func moduleCacheDir(modCache, path, version string) (string, error) {
+	if version == "" {
+		return "", fmt.Errorf("%s is replaced by a local directory which cannot be located", path)
+	}
+	escapedPath, err := module.EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(modCache, filepath.FromSlash(escapedPath+"@"+escapedVersion))
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("%s@%s is not available in the module cache", path, version)
+	}
+	return dir, nil
+}
+
+// moduleCacheVersions returns the versions of module path extracted in the
+// module cache rooted at modCache, sorted in increasing order. Invalid module
+// paths have no versions.
+func moduleCacheVersions(modCache, path string) ([]string, error) {
+	escaped, err := module.EscapePath(path)
+	if err != nil {
+		return nil, nil
+	}
+	escaped = filepath.FromSlash(escaped)
+	fis, err := ioutil.ReadDir(filepath.Join(modCache, filepath.Dir(escaped)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list versions of %s in the module cache", path)
+	}
+	prefix := filepath.Base(escaped) + "@"
+	var versions []string
+	for _, fi := range fis {
+		if !fi.IsDir() || !strings.HasPrefix(fi.Name(), prefix) {
+			continue
+		}
+		if version, err := module.UnescapeVersion(strings.TrimPrefix(fi.Name(), prefix)); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.Compare(versions[i], versions[j]) < 0
+	})
+	return versions, nil
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/spf13/cobra"
 	"io"
 	"os"
-	"os/exec"
 	"strings"
 )
 
@@ -16,6 +15,24 @@ type CliOptions struct {
 	LicensesToInclude   []string
 	LicensesToCheck     []string
 	IncludeIndirectDeps bool
+	IncludeStd          bool
+	Targets             []string
+	Offline             bool
+	ProxyFallback       bool
+	Verify              bool
+	Categories          []string
+	Monorepo            string
+	Dir                 string
+	GoCommand           string
+	Env                 []string
+	FailOn              string
+	GoMod               string
+	GoSum               string
+	// Evaluate is the module@version of the evaluate command
+	Evaluate string
+	// ImportChains reports the import chain pulling in every dependency, set
+	// when checking licenses
+	ImportChains bool
 }
 
 const (
@@ -24,7 +41,7 @@ const (
 	CheckLicenses   = "checkLicenses"
 )
 
-// `go list -e ./...` is run to determine all packages necessary to examine the dependencies of
+// `go list -e ./...` (or the packages of every module of the go.work workspace) is run to determine all packages necessary to examine the dependencies of
 func CliAllPackages(depsToSkip []string) (*cobra.Command, error) {
 	allPackages, err := getAllModulePackages()
 	if err != nil {
@@ -33,8 +50,8 @@ func CliAllPackages(depsToSkip []string) (*cobra.Command, error) {
 	return Cli(allPackages, depsToSkip), nil
 }
 
-// examines licenses of dependencies for any package in the pkgs array
-// dependencies that are in depsToSkip are not analyzed (for example, github.com/mitchellh/go-homedir which is needed in mac but not linux)
+// examines licenses of dependencies for any package in the pkgs array, as built for the --targets platforms (linux/amd64 by default, or the GOOS/GOARCH of --env)
+// dependencies that are in depsToSkip are not analyzed
 func Cli(pkgs, depsToSkip []string) *cobra.Command {
 	opts := &CliOptions{}
 	optionsFunc := func(app *cobra.Command) {
@@ -42,11 +59,27 @@ func Cli(pkgs, depsToSkip []string) *cobra.Command {
 		pflags.StringSliceVarP(&opts.LicensesToSkip, SkipLicenses, "s", nil, "licenses to not include in the output list.")
 		pflags.StringSliceVarP(&opts.LicensesToInclude, IncludeLicenses, "i", nil, "only these licenses will be included in the list, if empty, all licenses will be included")
 		pflags.StringSliceVarP(&opts.LicensesToCheck, CheckLicenses, "c", nil, "only these licenses will be checked for. If any packages use these licenses, program will exit with status code 1.")
-		pflags.BoolVar(&opts.IncludeIndirectDeps, "include-indirect", false, "only examine direct dependencies from the module's go.mod")
+		pflags.BoolVar(&opts.IncludeStd, "include-std", false, "also examine the Go runtime and standard library, with the version of the go command, or the one binaries were built with, and the text of $GOROOT/LICENSE and PATENTS")
+		pflags.BoolVar(&opts.IncludeIndirectDeps, "include-indirect", false, "also examine dependencies marked as indirect in the module's go.mod, annotated with the direct dependencies introducing them")
+		pflags.BoolVar(&opts.Offline, "offline", false, "never download modules nor modify go.mod/go.sum, report modules missing from the module cache as not available")
+		pflags.BoolVar(&opts.Verify, "verify", false, "compare the files of the modules with their go.sum hashes before reading their licenses, reporting mismatches as errors")
+		pflags.BoolVar(&opts.ProxyFallback, "proxy-fallback", false, "download from GOPROXY the license files of the modules missing from the module cache, or without one there, even with --offline")
+		pflags.StringSliceVar(&opts.Categories, "categories", []string{CategoryRuntime}, "dependency categories to list and check, among runtime, tool and test-only")
+		pflags.StringVar(&opts.Dir, "dir", "", "directory the packages are examined in, the current one by default")
+		pflags.StringVar(&opts.GoCommand, "go", "", "path of the go command, go from PATH by default")
+		pflags.StringArrayVar(&opts.Env, "env", nil, "KEY=value variable of the go command environment, ex: GOPRIVATE=example.com, may be repeated")
+		pflags.StringVar(&opts.FailOn, "fail-on", "none", "fail if a dependency has a diagnostic of this severity or above, among none, info, warning and error, error by default with --checkLicenses")
+		pflags.StringVar(&opts.GoMod, "gomod", "", "examine the modules required by this go.mod file instead of the packages, without the source tree of its module")
+		pflags.StringVar(&opts.GoSum, "gosum", "", "go.sum file of the --gomod file, the go.sum file next to it by default")
+		pflags.StringVar(&opts.Monorepo, "monorepo", "", "examine every module whose go.mod is under this directory instead of the packages, skipping vendor and testdata directories")
+		pflags.StringSliceVarP(&opts.Targets, "targets", "t", []string{"linux/amd64"}, "goos/goarch[+tag...] targets whose dependencies are examined, ex: linux/arm64+enterprise, the GOOS/GOARCH of --env if set there")
 	}
 	app := &cobra.Command{
 		Use: "osagen",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := envTargets(opts, cmd.Flag("targets").Changed); err != nil {
+				return err
+			}
 			licensesToDisplay, err := GetTemplatesSet()
 			if err != nil {
 				return err
@@ -101,6 +134,12 @@ func Cli(pkgs, depsToSkip []string) *cobra.Command {
 					outC <- buf.String()
 				}()
 
+				// explain every violation with the imports responsible for it
+				opts.ImportChains = true
+				// dependencies whose license cannot be read must not pass the check
+				if !cmd.Flag("fail-on").Changed {
+					opts.FailOn = SeverityError.String()
+				}
 				err = run(pkgs, depsToSkip, tempSet, opts)
 
 				// back to normal state
@@ -122,36 +161,93 @@ func Cli(pkgs, depsToSkip []string) *cobra.Command {
 		},
 	}
 
+	app.AddCommand(&cobra.Command{
+		Use:   "evaluate module@version",
+		Short: "examine the licenses of the modules requiring module@version would add, without modifying go.mod",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Evaluate = args[0]
+			return app.RunE(cmd, args)
+		},
+	})
+
 	cliutils.ApplyOptions(app, []cliutils.OptionsFunc{optionsFunc})
 	return app
 }
 
+// envTargets replaces the default --targets with the platform set by GOOS or
+// GOARCH in --env, which would otherwise be overridden. It returns an error if
+// both set the platform.
+func envTargets(opts *CliOptions, targetsSet bool) error {
+	for _, v := range opts.Env {
+		if strings.HasPrefix(v, "GOOS=") || strings.HasPrefix(v, "GOARCH=") {
+			if targetsSet {
+				return fmt.Errorf("--env %s conflicts with --targets, set the platform with only one of them", v)
+			}
+			opts.Targets = nil
+			return nil
+		}
+	}
+	return nil
+}
+
 // pkgs are the packages in the module whose dependencies are analyzed for Licenses
 // depsToSkip are dependencies that will be skipped
 // licenses are the licenses (Apache License, Mozilla License) that will be handled
 func run(pkgs, depsToSkip []string, licenses map[string]interface{}, opts *CliOptions) error {
-
+	targets, err := ParseTargets(opts.Targets)
+	if err != nil {
+		return err
+	}
+	failOn, err := ParseSeverity(opts.FailOn)
+	if err != nil {
+		return err
+	}
+	categories, err := ParseCategories(opts.Categories)
+	if err != nil {
+		return err
+	}
 	glooOptions := &Options{
 		RunAll:              false,
 		Words:               false,
 		PrintConfidence:     false,
 		UseMarkdown:         true,
-		HelperListGlooPkgs:  false,
 		Pkgs:                pkgs,
 		Product:             NewGlooProductLicenseHandler(depsToSkip, licenses),
 		IncludeIndirectDeps: opts.IncludeIndirectDeps,
+		IncludeStd:          opts.IncludeStd,
+		Targets:             targets,
+		Offline:             opts.Offline,
+		ProxyFallback:       opts.ProxyFallback,
+		Verify:              opts.Verify,
+		Categories:          categories,
+		Monorepo:            opts.Monorepo,
+		Dir:                 opts.Dir,
+		GoCommand:           opts.GoCommand,
+		Env:                 opts.Env,
+		FailOn:              failOn,
+		GoMod:               opts.GoMod,
+		GoSum:               opts.GoSum,
+		Evaluate:            opts.Evaluate,
+		ImportChains:        opts.ImportChains,
 	}
 	return PrintLicensesWithOptions(glooOptions)
 }
 
 func getAllModulePackages() ([]string, error) {
-	cmd := exec.Command("go", "list", "-e", "./...")
-	out, err := cmd.CombinedOutput()
+	patterns, err := defaultPatterns(loadOptions{})
 	if err != nil {
 		return nil, err
 	}
-	outStr := string(out)
-	return strings.Split(outStr, "\n"), nil
+	listed, err := loadOptions{}.listPackages(Target{}, nil, patterns)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []string
+	for _, pkg := range listed {
+		pkgs = append(pkgs, pkg.ImportPath)
+	}
+	return pkgs, nil
 }
 
 type LicenseValidator struct {
@@ -180,19 +276,10 @@ type GlooProductLicenseHandler struct {
 	DependenciesToSkip []string
 }
 
-var dependenciesToSkip = []string{
-	"github.com/mitchellh/go-homedir",
-	"github.com/containerd/continuity",
-	"github.com/keybase/go-ps",
-	"github.com/golang/mock",
-	"github.com/containerd/continuity",
-}
-
 func NewGlooProductLicenseHandler(depsToSkip []string, licensesToProcess map[string]interface{}) *GlooProductLicenseHandler {
-	dependenciesToSkip = append(dependenciesToSkip, depsToSkip...)
 	return &GlooProductLicenseHandler{
 		LicensesToProcess:  licensesToProcess,
-		DependenciesToSkip: dependenciesToSkip,
+		DependenciesToSkip: depsToSkip,
 	}
 }
 
@@ -0,0 +1,95 @@
+package license
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity is the importance of a Diagnostic.
+type Severity int
+
+const (
+	// SeverityNone is lower than every diagnostic, failing on it never fails
+	SeverityNone Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"none", "info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses one of "none", "info", "warning" and "error".
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityNone, fmt.Errorf("unknown severity %q, expected one of %s",
+		s, strings.Join(severityNames, ", "))
+}
+
+// Diagnostic is an issue found while analyzing a dependency, which does not
+// stop the analysis of the others.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return d.Severity.String() + ": " + d.Message
+}
+
+// errorDiagnostic returns an error diagnostic for err.
+func errorDiagnostic(err error) Diagnostic {
+	return Diagnostic{Severity: SeverityError, Message: strings.Replace(err.Error(), "\n", " ", -1)}
+}
+
+// mergeDiagnostics returns a with the diagnostics of b it does not contain appended.
+func mergeDiagnostics(a, b []Diagnostic) []Diagnostic {
+	for _, d := range b {
+		found := false
+		for _, e := range a {
+			if e == d {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, d)
+		}
+	}
+	return a
+}
+
+// failingDiagnostics returns an error listing the diagnostics of the licenses
+// kept by product at or above the failOn severity, nil if there are none or
+// failOn is SeverityNone.
+func failingDiagnostics(licenses []License, product Product, failOn Severity) error {
+	if failOn == SeverityNone {
+		return nil
+	}
+	var failing []string
+	for _, l := range licenses {
+		if product.SkipLicense(l) {
+			continue
+		}
+		for _, d := range l.Diagnostics {
+			if d.Severity >= failOn {
+				failing = append(failing, l.Package+": "+d.String())
+			}
+		}
+	}
+	if len(failing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d diagnostics at or above the %s severity:\n%s",
+		len(failing), failOn, strings.Join(failing, "\n"))
+}
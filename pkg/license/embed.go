@@ -0,0 +1,65 @@
+package license
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// embedLicenses attributes the files embedded by the imported packages of a
+// dependency to their closest license file, below the dependency root which
+// is not searched, such as the license of a font or of a web UI. It returns one
+// entry per license file, named after its directory, and the embedded files
+// without one, covered by the license of the dependency, relative to its root.
+func (lm *licenseMatcher) embedLicenses(info *PkgInfo, modLicense License) ([]License, []string, error) {
+	var licenses []License
+	var rest []string
+	byPath := map[string]int{}
+	for _, file := range info.EmbedFiles {
+		rel, err := filepath.Rel(info.Dir, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		path, err := findNestedLicense(filepath.Dir(file), info.Dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if path == "" {
+			rest = append(rest, rel)
+			continue
+		}
+		if i, ok := byPath[path]; ok {
+			licenses[i].Embedded = append(licenses[i].Embedded, rel)
+			continue
+		}
+		m, err := lm.match(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		dir, err := filepath.Rel(info.Dir, filepath.Dir(path))
+		if err != nil {
+			return nil, nil, err
+		}
+		license := modLicense
+		license.Package = info.ImportPath + "/" + filepath.ToSlash(dir)
+		license.Diagnostics = nil
+		license.Native = nil
+		license.Path = path
+		license.InheritedFrom = ""
+		license.Score = m.Score
+		license.Template = m.Template
+		license.ExtraWords = m.ExtraWords
+		license.MissingWords = m.MissingWords
+		license.FileContent = m.FileContent
+		license.Embedded = []string{rel}
+		byPath[path] = len(licenses)
+		licenses = append(licenses, license)
+	}
+	for i := range licenses {
+		licenses[i].Diagnostics = []Diagnostic{{
+			Severity: SeverityInfo,
+			Message:  fmt.Sprintf("license of %d files embedded with //go:embed", len(licenses[i].Embedded)),
+		}}
+	}
+	return licenses, rest, nil
+}
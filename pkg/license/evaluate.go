@@ -0,0 +1,79 @@
+package license
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// listCandidateLicenses returns the licenses of the modules that requiring
+// candidate, a module@version query, would add to the build list of the module
+// in lo.Dir, including new versions of modules it already requires. The
+// candidate is resolved through GOPROXY in a throwaway copy of the module's
+// go.mod and go.sum files, which are left untouched.
+func listCandidateLicenses(candidate string, lo loadOptions) ([]License, error) {
+	lo.NoWorkspace = true
+	values, err := lo.goEnv("GOMOD")
+	if err != nil {
+		return nil, err
+	}
+	goMod := values[0]
+	if goMod == "" || goMod == os.DevNull {
+		return nil, fmt.Errorf("evaluating %s requires a go.mod file", candidate)
+	}
+
+	offline := lo.Offline
+	lo, cleanup, err := throwawayModule(goMod, "", lo)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	// the current build list is listed in the copy too, where the go command
+	// may update go.mod and go.sum regardless of GOFLAGS
+	modules, err := lo.listModules("-e", "all")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list the modules of the build list")
+	}
+	current := map[string]bool{}
+	for _, mod := range modules {
+		current[mod.Path+"@"+mod.Version] = true
+	}
+	if _, err := lo.run(Target{}, "get", candidate); err != nil {
+		return nil, errors.Wrapf(err, "unable to require %s", candidate)
+	}
+	// without packages importing it, go get marks the candidate as indirect,
+	// require it directly so that it introduces the modules it adds
+	path, _ := splitModVersion(candidate)
+	resolved, err := lo.listModules(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to require %s", candidate)
+	}
+	require := path + "@" + resolved[0].Version
+	if _, err := lo.run(Target{}, "mod", "edit", "-droprequire="+path, "-require="+require); err != nil {
+		return nil, errors.Wrapf(err, "unable to require %s", candidate)
+	}
+	modules, err = lo.listModules("-e", "all")
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list the modules required with %s", candidate)
+	}
+	var added []string
+	for _, mod := range modules {
+		if !mod.Main && !current[mod.Path+"@"+mod.Version] {
+			added = append(added, mod.Path)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	if !offline {
+		if _, err := lo.run(Target{}, append([]string{"mod", "download"}, added...)...); err != nil {
+			return nil, errors.Wrap(err, "unable to download mod dependencies into mod cache")
+		}
+	}
+	modules, err = lo.listModules(append([]string{"-e"}, added...)...)
+	if err != nil {
+		return nil, err
+	}
+	return listModulesLicenses(modules, lo)
+}
@@ -0,0 +1,140 @@
+package license
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// listModFileLicenses returns the licenses of the modules required by a
+// standalone go.mod file, without the source tree of its module. goSum
+// defaults to the go.sum file next to goMod. Without packages to analyze,
+// modules are reported whether or not they provide packages to the module,
+// and their categories are unknown.
+func listModFileLicenses(goMod, goSum string, lo loadOptions) ([]License, error) {
+	offline := lo.Offline
+	lo, cleanup, err := throwawayModule(goMod, goSum, lo)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	if !offline {
+		if _, err := lo.run(Target{}, "mod", "download"); err != nil {
+			return nil, errors.Wrap(err, "unable to download mod dependencies into mod cache")
+		}
+	}
+	modules, err := lo.listModules("-e", "all")
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to resolve the modules required by %s", goMod)
+	}
+	var selected []*goListModule
+	for _, mod := range modules {
+		if mod.Main || (mod.Indirect && !lo.IncludeIndirectDeps) {
+			continue
+		}
+		selected = append(selected, mod)
+	}
+	return listModulesLicenses(selected, lo)
+}
+
+// throwawayModule copies the go.mod file, and the go.sum file if any, into a
+// temporary module and returns the options to analyze it, which the go
+// command may update, and a function removing it. goSum defaults to the
+// go.sum file next to goMod.
+func throwawayModule(goMod, goSum string, lo loadOptions) (loadOptions, func(), error) {
+	if goSum == "" {
+		goSum = filepath.Join(filepath.Dir(goMod), "go.sum")
+		if _, err := os.Stat(goSum); err != nil {
+			goSum = ""
+		}
+	}
+	dir, err := ioutil.TempDir("", "go-list-licenses")
+	if err != nil {
+		return lo, nil, errors.Wrap(err, "unable to create a throwaway module")
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	files := map[string]string{"go.mod": goMod}
+	if goSum != "" {
+		files["go.sum"] = goSum
+	}
+	for name, path := range files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			cleanup()
+			return lo, nil, errors.Wrapf(err, "unable to read %s", path)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			cleanup()
+			return lo, nil, errors.Wrap(err, "unable to create a throwaway module")
+		}
+	}
+
+	lo.Dir = dir
+	lo.NoWorkspace = true
+	if err := absReplacements(filepath.Dir(goMod), lo); err != nil {
+		cleanup()
+		return lo, nil, err
+	}
+	// the throwaway module may be updated, such as to add missing go.sum entries
+	lo.ModMode = "mod"
+	if lo.Offline {
+		lo.Offline = false
+		lo.Env = append(append([]string{}, lo.Env...), "GOPROXY=off", "GOTOOLCHAIN=local")
+	}
+	return lo, cleanup, nil
+}
+
+// listModulesLicenses returns the licenses of modules of the build list of
+// the module in lo.Dir, annotated with the module graph. A module graph which
+// cannot be loaded, such as offline with modules missing from the module
+// cache, is reported with a warning diagnostic on every module instead.
+func listModulesLicenses(modules []*goListModule, lo loadOptions) ([]License, error) {
+	var infos []*PkgInfo
+	for _, mod := range modules {
+		infos = append(infos, newModuleInfo(mod))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ImportPath < infos[j].ImportPath
+	})
+	graph, graphErr := loadModGraph(lo)
+	if graphErr == nil {
+		graph.annotate(infos)
+	}
+	licenses, err := matchLicenses(infos, lo)
+	if err != nil {
+		return nil, err
+	}
+	if graphErr != nil {
+		addModGraphDiagnostic(licenses, graphErr)
+	}
+	return licenses, nil
+}
+
+// absReplacements makes the directory replacements of the go.mod file in
+// lo.Dir, relative to modDir, absolute.
+func absReplacements(modDir string, lo loadOptions) error {
+	goMod, err := readGoMod(lo)
+	if err != nil || goMod == nil {
+		return err
+	}
+	for _, r := range goMod.Replace {
+		if r.New.Version != "" || filepath.IsAbs(r.New.Path) {
+			continue
+		}
+		old := r.Old.Path
+		if r.Old.Version != "" {
+			old += "@" + r.Old.Version
+		}
+		path, err := filepath.Abs(filepath.Join(modDir, r.New.Path))
+		if err != nil {
+			return errors.Wrapf(err, "unable to resolve the replacement of %s", old)
+		}
+		if _, err := lo.run(Target{}, "mod", "edit", "-replace", old+"="+path); err != nil {
+			return errors.Wrapf(err, "unable to resolve the replacement of %s", old)
+		}
+	}
+	return nil
+}
@@ -1,12 +1,12 @@
 package license
 
 import (
+	"archive/zip"
 	"bufio"
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os/exec"
+	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -189,51 +189,13 @@ func matchTemplates(license []byte, templates []*Template) MatchResult {
 	}
 }
 
-type MissingError struct {
-	Err string
-}
-
-func (err *MissingError) Error() string {
-	return err.Err
-}
-
-func getPackagesInfo(gopath string, pkgs []string) ([]*PkgInfo, error) {
-	args := []string{"list", "-e", "-json"}
-	// TODO: split the list for platforms which do not support massive argument lists.
-	args = append(args, pkgs...)
-	cmd := exec.Command("go", args...)
-	cmd.Env = fixEnv(gopath)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("go %s failed with:\n%s",
-			strings.Join(args, " "), string(out))
-	}
-	infos := make([]*PkgInfo, 0, len(pkgs))
-	decoder := json.NewDecoder(bytes.NewBuffer(out))
-	for _, pkg := range pkgs {
-		info := &PkgInfo{}
-		err := decoder.Decode(info)
-		if err != nil {
-			return nil, fmt.Errorf("could not retrieve package information for %s", pkg)
-		}
-		if pkg != info.ImportPath {
-			return nil, fmt.Errorf("package information mismatch: asked for %s, got %s",
-				pkg, info.ImportPath)
-		}
-		if info.Error != nil && info.Name == "" {
-			info.Name = info.ImportPath
-		}
-		infos = append(infos, info)
-	}
-	return infos, err
-}
-
 var (
 	reLicense = regexp.MustCompile(`(?i)^(?:` +
 		`((?:un)?licen[sc]e)|` +
 		`((?:un)?licen[sc]e\.(?:md|markdown|txt))|` +
 		`(copy(?:ing|right)(?:\.[^.]+)?)|` +
-		`(licen[sc]e\.[^.]+)` +
+		`(licen[sc]e\.[^.]+)|` +
+		`(ofl(?:\.txt)?)` +
 		`)$`)
 )
 
@@ -252,20 +214,62 @@ func scoreLicenseName(name string) float64 {
 		return 0.8
 	case m[4] != "":
 		return 0.7
+	case m[5] != "":
+		// the license file of fonts under the SIL Open Font License
+		return 0.6
 	}
 	return 0.
 }
 
-// findLicense looks for license files in package import path, and down to
-// parent directories until a file is found or $GOPATH/src is reached. It
-// returns the path and score of the best entry, an empty string if none was
-// found.
+// findLicense looks for license files in the package directory, and for
+// packages outside of modules, down to parent directories until a file is
+// found or $GOPATH/src is reached. Modules are only searched at their root,
+// see findParentLicense for nested modules. It returns the path of the best
+// entry, an empty string if none was found.
 func findLicense(info *PkgInfo) (string, error) {
-	lookPath := info.Root
-	fis, err := ioutil.ReadDir(lookPath)
+	lookPath := info.Dir
+	stopPath := lookPath
+	if info.Dir != info.Root {
+		stopPath = filepath.Join(info.Root, "src")
+	}
+	for {
+		path, err := findLicenseInDir(lookPath)
+		if err != nil {
+			return "", err
+		}
+		if path != "" {
+			return path, nil
+		}
+		parent := filepath.Dir(lookPath)
+		if lookPath == stopPath || parent == lookPath || !strings.HasPrefix(parent, stopPath) {
+			return "", nil
+		}
+		lookPath = parent
+	}
+}
+
+// findNestedLicense looks for license files in a package directory of a
+// module, and down to parent directories until the module root, which is not
+// searched. It returns the path of the best entry of the closest directory, an
+// empty string if none was found.
+func findNestedLicense(pkgDir, modDir string) (string, error) {
+	lookPath := pkgDir
+	for lookPath != modDir && strings.HasPrefix(lookPath, modDir+string(filepath.Separator)) {
+		path, err := findLicenseInDir(lookPath)
+		if err != nil || path != "" {
+			return path, err
+		}
+		lookPath = filepath.Dir(lookPath)
+	}
+	return "", nil
+}
+
+// findLicenseInDir returns the path of the file of dir most likely to be a
+// license file, an empty string if none was found.
+func findLicenseInDir(dir string) (string, error) {
+	fis, err := ioutil.ReadDir(dir)
 	if err != nil {
-		println(fmt.Sprintf("%+v\n", info))
-		return "", errors.Wrapf(err, "unable to read dir at %s", lookPath)
+		return "", errors.Wrapf(err, "unable to read dir at %s", dir)
 	}
 	bestScore := float64(0)
 	bestName := ""
@@ -280,16 +284,20 @@ func findLicense(info *PkgInfo) (string, error) {
 		}
 	}
 	if bestName != "" {
-		return filepath.Join(lookPath, bestName), nil
+		return filepath.Join(dir, bestName), nil
 	}
 	return "", nil
 }
 
 type License struct {
-	Package  string
-	Score    float64
-	Template *Template
-	Path     string
+	Package string
+	Version string
+	// ReplacePath and ReplaceVersion identify the module replacing Package, if any
+	ReplacePath    string
+	ReplaceVersion string
+	Score          float64
+	Template       *Template
+	Path           string
 	// ManualPath indicates the URI of the license file. If provided, overrides the auto-generated URI path
 	ManualPath   string
 	Err          string
@@ -297,63 +305,356 @@ type License struct {
 	MissingWords []string
 	// text from the license file
 	FileContent []byte
+	// UsedBy lists the requested packages which pull in this dependency
+	UsedBy []string
+	// UsedByModules lists the first-party modules which pull in this dependency
+	UsedByModules []string
+	// Targets lists the targets this dependency is built for, if any were requested
+	Targets []string
+	// Diagnostics are the issues found while analyzing this dependency
+	Diagnostics []Diagnostic
+	// InheritedFrom is the parent module@version the license was found in, if
+	// the module does not have its own license file
+	InheritedFrom string
+	// Category is one of CategoryRuntime, CategoryTool and CategoryTestOnly, if known
+	Category string
+	// IntroducedBy lists the direct dependencies pulling in this dependency and
+	// Depth is its minimum depth in the module graph, if known
+	IntroducedBy []string
+	Depth        int
+	// ImportChain is the shortest import chain from a requested package to
+	// this dependency, if known
+	ImportChain []string
+	// Native is the native code this dependency links or bundles, if any
+	Native *NativeCode
+	// Embedded lists the files embedded with //go:embed covered by this
+	// license, relative to the dependency root
+	Embedded []string
 }
 
-func listLicenses(pkgs []string, includeIndirectDeps bool) ([]License, error) {
-	templates, err := loadTemplates()
-	if err != nil {
-		return nil, err
-	}
-	var infos []*PkgInfo
-	stdSet := map[string]bool{}
+// listLicenses returns the licenses of the dependencies of pkgs. Offline, it
+// also fails if listing them modified go.mod or go.sum.
+func listLicenses(pkgs []string, lo loadOptions) ([]License, error) {
+	licenses, _, err := listLicensesAndGraph(pkgs, lo, lo.IncludeIndirectDeps)
+	return licenses, err
+}
 
-	infos, err = listModDependencies(includeIndirectDeps)
+// listLicensesAndGraph returns the licenses of listLicenses and, if withGraph
+// is set, the module graph attributing indirect dependencies to the direct
+// ones introducing them. A module graph which cannot be loaded, such as
+// offline when it requires go.mod files missing from the module cache, is
+// reported with a warning diagnostic on every module instead.
+func listLicensesAndGraph(pkgs []string, lo loadOptions, withGraph bool) ([]License, *modGraph, error) {
+	var snapshot modFilesSnapshot
+	if lo.Offline {
+		var err error
+		snapshot, err = snapshotModFiles(lo)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	infos, err := listTargetsDependencies(pkgs, lo)
 	if err != nil {
 		if _, ok := err.(*MissingError); ok {
-			return nil, err
+			return nil, nil, err
+		}
+		return nil, nil, errors.Wrapf(err, "could not list %s dependencies", strings.Join(pkgs, " "))
+	}
+	var graph *modGraph
+	var graphErr error
+	if withGraph && lo.Gopath == "" {
+		graph, graphErr = loadModGraph(lo)
+		if graphErr == nil {
+			graph.annotate(infos)
+		}
+	}
+	if lo.Offline {
+		if err := snapshot.verify(); err != nil {
+			return nil, nil, err
 		}
-		return nil, fmt.Errorf("could not list %s dependencies: %s",
-			strings.Join(pkgs, " "), err)
 	}
+	licenses, err := matchLicenses(infos, lo)
+	if err != nil {
+		return nil, nil, err
+	}
+	if graphErr != nil {
+		addModGraphDiagnostic(licenses, graphErr)
+	}
+	return licenses, graph, nil
+}
 
-	// Cache matched licenses by path. Useful for package with a lot of
-	// subpackages like bleve.
-	matched := map[string]MatchResult{}
+// addModGraphDiagnostic warns every module of licenses that it could not be
+// attributed to a direct dependency since the module graph failed to load.
+func addModGraphDiagnostic(licenses []License, err error) {
+	for i := range licenses {
+		if licenses[i].Version != "" {
+			licenses[i].Diagnostics = append(licenses[i].Diagnostics, Diagnostic{
+				Severity: SeverityWarning,
+				Message:  "not attributed to a direct dependency: unable to load the module graph: " + err.Error(),
+			})
+		}
+	}
+}
 
+// matchLicenses finds the license file of every dependency and matches it
+// against the known license templates.
+// With lo.PerPackage, modules are replaced by one entry per imported package.
+// Otherwise, imported packages under a license file nested in their module are
+// reported in an entry per nested license file, in addition to the module one.
+// Dependencies which cannot be analyzed are reported with error diagnostics
+// instead of failing the others.
+func matchLicenses(infos []*PkgInfo, lo loadOptions) ([]License, error) {
+	lm, err := newLicenseMatcher(lo)
+	if err != nil {
+		return nil, err
+	}
 	licenses := []License{}
 	for _, info := range infos {
-		if info.Error != nil {
+		// modules missing from the module cache may still have a zip there, or
+		// be downloaded
+		if info.Error != nil && (info.Dir != "" || info.Version == "") {
 			licenses = append(licenses, License{
-				Package: info.Name,
-				Err:     info.Error.Err,
+				Package:        info.Name,
+				Version:        info.Version,
+				ReplacePath:    info.ReplacePath,
+				ReplaceVersion: info.ReplaceVersion,
+				Err:            info.Error.Err,
+				UsedBy:         info.UsedBy,
+				UsedByModules:  info.UsedByModules,
+				Targets:        info.Targets,
+				Category:       info.Category,
+				IntroducedBy:   info.IntroducedBy,
+				Depth:          info.Depth,
+				ImportChain:    info.ImportChain,
+				Diagnostics:    []Diagnostic{errorDiagnostic(errors.New(info.Error.Err))},
 			})
 			continue
 		}
-		if stdSet[info.ImportPath] {
+		if strings.Contains(info.ImportPath, "solo-io") {
+			continue
+		}
+		license := License{
+			Package:        info.ImportPath,
+			Version:        info.Version,
+			ReplacePath:    info.ReplacePath,
+			ReplaceVersion: info.ReplaceVersion,
+			UsedBy:         info.UsedBy,
+			UsedByModules:  info.UsedByModules,
+			Targets:        info.Targets,
+			Category:       info.Category,
+			IntroducedBy:   info.IntroducedBy,
+			Depth:          info.Depth,
+			ImportChain:    info.ImportChain,
+			Native:         info.Native,
+		}
+		if info.Native != nil {
+			license.Diagnostics = append(license.Diagnostics, nativeDiagnostic(info.Native))
+		}
+		if err := lm.matchLicense(info, &license); err != nil {
+			license.Err = err.Error()
+			license.Diagnostics = append(license.Diagnostics, errorDiagnostic(err))
+			licenses = append(licenses, license)
 			continue
 		}
-		path, err := findLicense(info)
+		embedLicenses, embedded, err := lm.embedLicenses(info, license)
+		if err != nil {
+			license.Diagnostics = append(license.Diagnostics, errorDiagnostic(err))
+		}
+		license.Embedded = embedded
+		pkgLicenses, err := lm.packageLicenses(info, license, lo.PerPackage)
+		if err != nil {
+			license.Diagnostics = append(license.Diagnostics, errorDiagnostic(err))
+		}
+		if !lo.PerPackage || len(info.Packages) == 0 {
+			licenses = append(licenses, license)
+		}
+		licenses = append(licenses, pkgLicenses...)
+		licenses = append(licenses, embedLicenses...)
+	}
+	return licenses, nil
+}
+
+// matchLicense finds and matches the license of a module or package, and
+// records the diagnostics of the license found.
+func (lm *licenseMatcher) matchLicense(info *PkgInfo, license *License) error {
+	var path string
+	var err error
+	if info.Dir != "" {
+		path, err = findLicense(info)
+		if err != nil {
+			return err
+		}
+	}
+	if path == "" && info.Dir != "" {
+		path, license.InheritedFrom, err = lm.findParentLicense(info)
+		if err != nil {
+			return err
+		}
+		if license.InheritedFrom != "" {
+			license.Diagnostics = append(license.Diagnostics, Diagnostic{
+				Severity: SeverityInfo,
+				Message:  "license inherited from " + license.InheritedFrom,
+			})
+		}
+	}
+	// verify the module the license comes from
+	if license.InheritedFrom != "" {
+		parent, version := splitModVersion(license.InheritedFrom)
+		err = lm.verifyModuleDir(info, parent, version, filepath.Dir(path), license)
+	} else if modPath, version, ok := zipModule(info); ok {
+		err = lm.verifyModuleDir(info, modPath, version, info.Dir, license)
+	}
+	if err != nil {
+		return err
+	}
+	license.Path = path
+	if path != "" {
+		m, err := lm.match(path)
+		if err != nil {
+			return err
+		}
+		license.Score = m.Score
+		license.Template = m.Template
+		license.ExtraWords = m.ExtraWords
+		license.MissingWords = m.MissingWords
+		license.FileContent = m.FileContent
+	}
+	// without a directory, the module zip may be in the module cache
+	found := false
+	if info.Dir == "" {
+		found, err = lm.cacheZipLicense(info, license)
+		if err != nil {
+			return err
+		}
+	}
+	if license.Path == "" && !found {
+		fetched, err := lm.fetchLicense(info, license)
+		if info.Error != nil && !fetched {
+			if err != nil {
+				return fmt.Errorf("%s, %s", info.Error.Err, err)
+			}
+			return errors.New(info.Error.Err)
+		}
+		if err != nil {
+			license.Diagnostics = append(license.Diagnostics, Diagnostic{
+				Severity: SeverityWarning,
+				Message:  "unable to download the module: " + err.Error(),
+			})
+		}
+	}
+	if license.Path == "" {
+		license.Diagnostics = append(license.Diagnostics, Diagnostic{
+			Severity: SeverityWarning,
+			Message:  "no license file found",
+		})
+	}
+	if info.ReplacePath != "" {
+		warning, err := lm.compareUpstream(info, *license)
+		if err != nil {
+			license.Diagnostics = append(license.Diagnostics, Diagnostic{
+				Severity: SeverityWarning,
+				Message:  "unable to compare with the upstream module: " + err.Error(),
+			})
+		} else if warning != "" {
+			license.Diagnostics = append(license.Diagnostics, Diagnostic{
+				Severity: SeverityWarning,
+				Message:  warning,
+			})
+		}
+	}
+	return nil
+}
+
+// licenseMatcher matches license files against the known license templates.
+type licenseMatcher struct {
+	templates []*Template
+	// Cache matched licenses by path. Useful for package with a lot of
+	// subpackages like bleve.
+	matched map[string]MatchResult
+	// modCache is the module cache directory, looked up on first use
+	modCache string
+	// lo runs the go command looking up the module cache
+	lo loadOptions
+	// fetcher downloads the modules without a license in the module cache, if
+	// set
+	fetcher moduleFetcher
+	// goSums holds the go.sum hashes verified with lo.Verify, read on first use
+	goSums map[string]string
+}
+
+func newLicenseMatcher(lo loadOptions) (*licenseMatcher, error) {
+	templates, err := loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	lm := &licenseMatcher{
+		templates: templates,
+		matched:   map[string]MatchResult{},
+		lo:        lo,
+	}
+	if lo.ProxyFallback {
+		lm.fetcher = newProxyFetcher(lo)
+	}
+	return lm, nil
+}
+
+// match returns the best template matching the license file at path.
+func (lm *licenseMatcher) match(path string) (MatchResult, error) {
+	fpath := filepath.Join(path)
+	m, ok := lm.matched[fpath]
+	if !ok {
+		data, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return MatchResult{}, errors.Wrapf(err, "Unable to read file at %s", fpath)
+		}
+		m = matchTemplates(data, lm.templates)
+		lm.matched[fpath] = m
+	}
+	return m, nil
+}
+
+// packageLicenses attributes every imported package of a module to its closest
+// license file. With perPackage, it returns one entry per package, using the
+// module license for packages without a nested license file. Otherwise, it
+// returns one entry per nested license file, named after its directory.
+func (lm *licenseMatcher) packageLicenses(info *PkgInfo, modLicense License, perPackage bool) ([]License, error) {
+	var licenses []License
+	byPath := map[string]bool{}
+	for _, pkg := range info.Packages {
+		path, err := findNestedLicense(pkg.Dir, info.Dir)
 		if err != nil {
 			return nil, err
 		}
-		if strings.Contains(info.ImportPath, "solo-io") {
+		if path == "" && !perPackage {
 			continue
 		}
-		license := License{
-			Package: info.ImportPath,
-			Path:    path,
+		license := modLicense
+		license.Diagnostics = nil
+		license.Native = nil
+		license.Embedded = nil
+		license.Package = pkg.ImportPath
+		if perPackage && pkg.Native != nil {
+			license.Native = pkg.Native
+			license.Diagnostics = append(license.Diagnostics, nativeDiagnostic(pkg.Native))
+		}
+		if !perPackage {
+			if byPath[path] {
+				continue
+			}
+			byPath[path] = true
+			rel, err := filepath.Rel(info.Dir, filepath.Dir(path))
+			if err != nil {
+				return nil, err
+			}
+			license.Package = info.ImportPath + "/" + filepath.ToSlash(rel)
 		}
 		if path != "" {
-			fpath := filepath.Join(path)
-			m, ok := matched[fpath]
-			if !ok {
-				data, err := ioutil.ReadFile(fpath)
-				if err != nil {
-					return nil, errors.Wrapf(err, "Unable to read file at %s", fpath)
-				}
-				m = matchTemplates(data, templates)
-				matched[fpath] = m
+			m, err := lm.match(path)
+			if err != nil {
+				return nil, err
 			}
+			license.Path = path
+			license.InheritedFrom = ""
 			license.Score = m.Score
 			license.Template = m.Template
 			license.ExtraWords = m.ExtraWords
@@ -365,6 +666,135 @@ func listLicenses(pkgs []string, includeIndirectDeps bool) ([]License, error) {
 	return licenses, nil
 }
 
+// moduleCache returns the module cache directory.
+func (lm *licenseMatcher) moduleCache() (string, error) {
+	if lm.modCache == "" {
+		modCache, err := goModCache(lm.lo)
+		if err != nil {
+			return "", err
+		}
+		lm.modCache = modCache
+	}
+	return lm.modCache, nil
+}
+
+// findParentLicense looks for the license of a module of the module cache in
+// its enclosing modules, for nested modules of multi-module repositories whose
+// zip does not contain the license file of the repository root. Parent modules
+// are looked up from the closest one, preferably at the same version, else at
+// the highest version available. It returns the license path and the parent
+// module@version it comes from, empty strings if none was found.
+func (lm *licenseMatcher) findParentLicense(info *PkgInfo) (string, string, error) {
+	if info.Version == "" || info.ReplacePath != "" {
+		return "", "", nil
+	}
+	modCache, err := lm.moduleCache()
+	if err != nil {
+		return "", "", err
+	}
+	if !strings.HasPrefix(info.Dir, modCache+string(filepath.Separator)) {
+		return "", "", nil
+	}
+	parent := info.ImportPath
+	for {
+		i := strings.LastIndex(parent, "/")
+		if i < 0 {
+			return "", "", nil
+		}
+		parent = parent[:i]
+		versions, err := moduleCacheVersions(modCache, parent)
+		if err != nil {
+			return "", "", err
+		}
+		if len(versions) == 0 {
+			continue
+		}
+		version := versions[len(versions)-1]
+		for _, v := range versions {
+			if v == info.Version {
+				version = v
+			}
+		}
+		dir, err := moduleCacheDir(modCache, parent, version)
+		if err != nil {
+			return "", "", err
+		}
+		path, err := findLicense(&PkgInfo{Dir: dir, Root: dir})
+		if err != nil || path != "" {
+			return path, parent + "@" + version, err
+		}
+	}
+}
+
+// compareUpstream returns a warning if the license of a replaced module
+// differs from the license of its replacement, or an empty string if they
+// match. It returns an error if the license of the upstream module cannot be
+// found, see upstreamLicense.
+func (lm *licenseMatcher) compareUpstream(info *PkgInfo, license License) (string, error) {
+	upstreamLicense, err := lm.upstreamLicense(info.ImportPath, info.Version)
+	if err != nil {
+		return "", err
+	}
+	upstream := "no license"
+	if upstreamLicense.Template != nil {
+		upstream = upstreamLicense.Template.Title
+	}
+	replacement := "no license"
+	if license.Template != nil {
+		replacement = license.Template.Title
+	}
+	if upstream == replacement {
+		return "", nil
+	}
+	return fmt.Sprintf("%s is replaced by %s whose license (%s) differs from upstream %s@%s (%s)",
+		info.ImportPath, strings.TrimSpace(info.ReplacePath+" "+info.ReplaceVersion),
+		replacement, info.ImportPath, info.Version, upstream), nil
+}
+
+// upstreamLicense returns the license of module path@version, looked up in its
+// module cache directory, in its zip kept in the module cache, and with a
+// proxy fallback, in its zip downloaded from the module proxy.
+func (lm *licenseMatcher) upstreamLicense(modPath, version string) (License, error) {
+	var license License
+	modCache, err := lm.moduleCache()
+	if err != nil {
+		return license, err
+	}
+	if dir, err := moduleCacheDir(modCache, modPath, version); err == nil {
+		path, err := findLicense(&PkgInfo{Dir: dir, Root: dir})
+		if err != nil || path == "" {
+			return license, err
+		}
+		m, err := lm.match(path)
+		license.Template = m.Template
+		return license, err
+	}
+	zipPath, err := moduleCacheZip(modCache, modPath, version)
+	if err != nil {
+		return license, err
+	}
+	zr, err := zip.OpenReader(zipPath)
+	if err == nil {
+		defer zr.Close()
+		return license, lm.matchZipLicense(&zr.Reader, modPath, version, zipPath, &license)
+	}
+	if !os.IsNotExist(err) {
+		return license, errors.Wrapf(err, "unable to read the zip of %s@%s", modPath, version)
+	}
+	if lm.fetcher == nil {
+		return license, fmt.Errorf("%s@%s is missing from the module cache", modPath, version)
+	}
+	data, url, err := lm.fetcher.fetchZip(modPath, version)
+	if err != nil {
+		return license, err
+	}
+	fetched, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return license, errors.Wrapf(err, "unable to read the zip of %s@%s", modPath, version)
+	}
+	return license, lm.matchZipLicense(fetched, modPath, version, url, &license)
+}
+
 // longestCommonPrefix returns the longest common prefix over import path
 // components of supplied licenses.
 func longestCommonPrefix(licenses []License) string {
@@ -406,12 +836,14 @@ func longestCommonPrefix(licenses []License) string {
 }
 
 // groupLicenses returns the input licenses after grouping them by license path
-// and find their longest import path common prefix. Entries with empty paths
-// are left unchanged.
+// and find their longest import path common prefix. Entries with empty paths,
+// entries inheriting the license of a parent module, and the standard library
+// entries of the Go versions binaries were built with, which share
+// $GOROOT/LICENSE, are left unchanged.
 func groupLicenses(licenses []License) ([]License, error) {
 	paths := map[string][]License{}
 	for _, l := range licenses {
-		if l.Path == "" {
+		if l.Path == "" || l.InheritedFrom != "" || l.Package == StdPackage {
 			continue
 		}
 		paths[l.Path] = append(paths[l.Path], l)
@@ -427,11 +859,16 @@ func groupLicenses(licenses []License) ([]License, error) {
 		}
 		l := v[0]
 		l.Package = prefix
+		for _, other := range v[1:] {
+			l.Diagnostics = mergeDiagnostics(l.Diagnostics, other.Diagnostics)
+			l.Native = mergeNative(l.Native, other.Native)
+			l.Embedded = mergeStrings(l.Embedded, other.Embedded)
+		}
 		paths[k] = []License{l}
 	}
 	kept := []License{}
 	for _, l := range licenses {
-		if l.Path == "" {
+		if l.Path == "" || l.InheritedFrom != "" || l.Package == StdPackage {
 			kept = append(kept, l)
 			continue
 		}
@@ -2,12 +2,14 @@ package license
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"github.com/solo-io/go-list-licenses/pkg/markdown"
 	"github.com/pkg/errors"
+	"github.com/solo-io/go-list-licenses/pkg/markdown"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -16,147 +18,730 @@ import (
 )
 
 // fixEnv returns a copy of the process environment where GOPATH is adjusted to
-// supplied value. It returns nil if gopath is empty.
+// supplied value and module mode is disabled. It returns nil if gopath is empty.
 func fixEnv(gopath string) []string {
 	if gopath == "" {
 		return nil
 	}
 	kept := []string{
 		"GOPATH=" + gopath,
+		"GO111MODULE=off",
 	}
 	for _, env := range os.Environ() {
-		if !strings.HasPrefix(env, "GOPATH=") {
+		if !strings.HasPrefix(env, "GOPATH=") && !strings.HasPrefix(env, "GO111MODULE=") {
 			kept = append(kept, env)
 		}
 	}
 	return kept
 }
 
-// expandPackages takes a list of package or package expressions and invoke go
-// list to expand them to packages. In particular, it handles things like "..."
-// and ".".
-func expandPackages(gopath string, pkgs []string) ([]string, error) {
-	args := []string{"list"}
-	args = append(args, pkgs...)
-	cmd := exec.Command("go", args...)
-	cmd.Env = fixEnv(gopath)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		output := string(out)
-		if strings.Contains(output, "cannot find package") ||
-			strings.Contains(output, "no buildable Go source files") {
-			return nil, &MissingError{Err: output}
+// setEnv returns a copy of base, or of the process environment if base is nil,
+// where the supplied KEY=value variables override existing ones.
+func setEnv(base []string, vars ...string) []string {
+	if base == nil {
+		base = os.Environ()
+	}
+	env := append([]string{}, vars...)
+	for _, e := range base {
+		overridden := false
+		for _, v := range vars {
+			if strings.HasPrefix(e, v[:strings.Index(v, "=")+1]) {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			env = append(env, e)
+		}
+	}
+	return env
+}
+
+// setModFlag returns a copy of env, or of the process environment if env is
+// nil, where the -mod flag of GOFLAGS is set to mode.
+func setModFlag(env []string, mode string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	flags := []string{}
+	for _, e := range env {
+		if !strings.HasPrefix(e, "GOFLAGS=") {
+			continue
+		}
+		flags = flags[:0]
+		for _, flag := range strings.Fields(strings.TrimPrefix(e, "GOFLAGS=")) {
+			if !strings.HasPrefix(flag, "-mod=") && !strings.HasPrefix(flag, "--mod=") {
+				flags = append(flags, flag)
+			}
+		}
+	}
+	return setEnv(env, "GOFLAGS="+strings.Join(append(flags, "-mod="+mode), " "))
+}
+
+// loadOptions configures how the go command loads the analyzed packages.
+type loadOptions struct {
+	// Gopath runs the go command in GOPATH mode with this GOPATH when set
+	Gopath string
+	// Dir is the directory the go command runs in, the current one if empty
+	Dir string
+	// NoWorkspace ignores go.work files, analyzing the module of Dir on its own
+	NoWorkspace bool
+	// GoCommand is the path of the go command, "go" from PATH if empty
+	GoCommand string
+	// Env lists KEY=value variables overriding the process environment of the
+	// go command, such as GOFLAGS, GOMODCACHE, GOPRIVATE or GOTOOLCHAIN
+	Env []string
+	// Targets are the platforms and build tags to load packages for, the
+	// platform of the go command if empty
+	Targets             []Target
+	IncludeIndirectDeps bool
+	// Offline never downloads modules nor updates go.mod and go.sum
+	Offline bool
+	// ModMode sets the -mod flag of GOFLAGS, keeping its other flags, to
+	// "readonly" offline if empty
+	ModMode string
+	// ProxyFallback downloads the license files of the modules missing from
+	// the module cache, or without one there, from GOPROXY, even offline
+	ProxyFallback bool
+	// Verify checks the files of the modules against their go.sum hashes
+	Verify bool
+	// PerPackage reports every imported package instead of every module
+	PerPackage bool
+	// Categories are the dependency categories to list, runtime ones if empty
+	Categories []string
+}
+
+// env returns the environment of the go command, nil for the process one.
+func (o loadOptions) env() []string {
+	env := fixEnv(o.Gopath)
+	if len(o.Env) > 0 {
+		env = setEnv(env, o.Env...)
+	}
+	modMode := o.ModMode
+	if o.Offline {
+		env = setEnv(env, "GOPROXY=off", "GOTOOLCHAIN=local")
+		if modMode == "" {
+			modMode = "readonly"
+		}
+	}
+	if modMode != "" {
+		env = setModFlag(env, modMode)
+	}
+	if o.NoWorkspace {
+		env = setEnv(env, "GOWORK=off")
+	}
+	return env
+}
+
+// cgoSet reports whether the user set CGO_ENABLED, in the environment or the
+// options.
+func (o loadOptions) cgoSet() bool {
+	if _, ok := os.LookupEnv("CGO_ENABLED"); ok {
+		return true
+	}
+	for _, v := range o.Env {
+		if strings.HasPrefix(v, "CGO_ENABLED=") {
+			return true
 		}
-		return nil, fmt.Errorf("'go %s' failed with:\n%s",
-			strings.Join(args, " "), output)
 	}
-	names := []string{}
-	for _, s := range strings.Split(string(out), "\n") {
-		s = strings.TrimSpace(s)
-		if s != "" {
-			names = append(names, s)
+	return false
+}
+
+// command returns the go command running args in Dir with the environment of
+// the options.
+func (o loadOptions) command(args ...string) *exec.Cmd {
+	goCommand := o.GoCommand
+	if goCommand == "" {
+		goCommand = "go"
+	}
+	cmd := exec.Command(goCommand, args...)
+	cmd.Env = o.env()
+	cmd.Dir = o.Dir
+	return cmd
+}
+
+// validateEnv returns an error if any of the variables is not of the form
+// KEY=value.
+func validateEnv(env []string) error {
+	for _, v := range env {
+		if strings.Index(v, "=") < 1 {
+			return fmt.Errorf("invalid environment variable %q, expected KEY=value", v)
 		}
 	}
-	return names, nil
+	return nil
+}
+
+// goListModule mirrors the Module field of `go list -json` output.
+type goListModule struct {
+	Path     string
+	Version  string
+	Main     bool
+	Indirect bool
+	Dir      string
+	Replace  *goListModule
+	Error    *PkgError
 }
 
-func listPackagesAndDeps(gopath string, pkgs []string) ([]string, error) {
-	pkgs, err := expandPackages(gopath, pkgs)
+// goListPackage mirrors the subset of `go list -json` output needed to walk
+// the build graph of the requested packages.
+type goListPackage struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	Root       string
+	Standard   bool
+	DepOnly    bool
+	ForTest    string
+	Imports    []string
+	Deps       []string
+	Module     *goListModule
+	Error      *PkgError
+	DepsErrors []*PkgError
+	GoFiles    []string
+	EmbedFiles []string
+	// the cgo and native files of the package, and its #cgo directives
+	CgoFiles     []string
+	CFiles       []string
+	CXXFiles     []string
+	HFiles       []string
+	SysoFiles    []string
+	CgoLDFLAGS   []string
+	CgoPkgConfig []string
+}
+
+// listModDependencies walks the build graph of pkgs with `go list -deps` and
+// returns one entry per module linked into them, each carrying the requested
+// packages which pull it in. Standard library packages are skipped.
+// IncludeIndirectDeps determines whether modules marked as indirect in go.mod
+// are listed.
+// When Gopath is set, the go command runs in GOPATH mode and, as there are no
+// modules, one entry is returned per package instead.
+// The build graph is the one of the supplied target, including tests if test
+// is set. Offline, packages of modules missing from the module cache are
+// returned with an error.
+func listModDependencies(pkgs []string, target Target, test bool, lo loadOptions) ([]*PkgInfo, error) {
+	flags := []string{"-deps"}
+	if test {
+		flags = append(flags, "-test")
+	}
+	flags = append(flags, target.buildFlags()...)
+	listed, err := lo.listPackages(target, flags, pkgs)
 	if err != nil {
 		return nil, err
 	}
-	args := []string{"list", "-f", "{{range .Deps}}{{.}}|{{end}}"}
-	args = append(args, pkgs...)
-	cmd := exec.Command("go", args...)
-	cmd.Env = fixEnv(gopath)
-	out, err := cmd.CombinedOutput()
+	natives, err := listNativeCode(pkgs, target, flags, lo)
 	if err != nil {
-		output := string(out)
-		if strings.Contains(output, "cannot find package") ||
-			strings.Contains(output, "no buildable Go source files") {
-			return nil, &MissingError{Err: output}
+		return nil, err
+	}
+
+	var roots []*goListPackage
+	byImportPath := map[string]*goListPackage{}
+	for _, pkg := range listed {
+		byImportPath[pkg.ImportPath] = pkg
+		if !pkg.DepOnly {
+			roots = append(roots, pkg)
 		}
-		return nil, fmt.Errorf("'go %s' failed with:\n%s",
-			strings.Join(args, " "), output)
 	}
-	deps := []string{}
-	seen := map[string]bool{}
-	for _, s := range strings.Split(string(out), "|") {
-		s = strings.TrimSpace(s)
-		if s != "" && !seen[s] {
-			deps = append(deps, s)
-			seen[s] = true
+	for _, root := range roots {
+		if err := packageError(root); err != nil {
+			return nil, err
 		}
 	}
-	for _, pkg := range pkgs {
-		if !seen[pkg] {
-			seen[pkg] = true
-			deps = append(deps, pkg)
+	chains := importChains(roots, byImportPath)
+
+	var depInfos []*PkgInfo
+	byKey := map[string]*PkgInfo{}
+	seenPackages := map[string]bool{}
+	for _, root := range roots {
+		rootPath := root.ImportPath
+		if root.ForTest != "" {
+			rootPath = root.ForTest
+		} else if root.Name == "main" && test {
+			rootPath = strings.TrimSuffix(rootPath, ".test")
+		}
+		deps := append([]string{root.ImportPath}, root.Deps...)
+		for _, dep := range deps {
+			pkg := byImportPath[dep]
+			if pkg == nil || pkg.Standard {
+				continue
+			}
+			// test variants of packages are listed as "path [root.test]"
+			pkgPath := strings.SplitN(pkg.ImportPath, " ", 2)[0]
+			if test && pkg.Name == "main" && strings.HasSuffix(pkgPath, ".test") {
+				// generated test main package
+				continue
+			}
+			key := pkgPath
+			if pkg.Module != nil {
+				if pkg.Module.Main || (pkg.Module.Indirect && !lo.IncludeIndirectDeps) {
+					continue
+				}
+				key = pkg.Module.Path
+			}
+			depInfo := byKey[key]
+			if depInfo == nil {
+				depInfo = newDepInfo(pkg, lo.Gopath == "")
+				byKey[key] = depInfo
+				depInfos = append(depInfos, depInfo)
+			}
+			if chain := chains[pkg.ImportPath]; len(chain) > 0 &&
+				(len(depInfo.ImportChain) == 0 || len(chain) < len(depInfo.ImportChain)) {
+				depInfo.ImportChain = chain
+			}
+			if !seenPackages[pkgPath] {
+				seenPackages[pkgPath] = true
+				native, ok := natives[pkg.ImportPath]
+				if !ok {
+					native = nativeCode(pkg)
+				}
+				depInfo.Native = mergeNative(depInfo.Native, native)
+				for _, file := range pkg.EmbedFiles {
+					depInfo.EmbedFiles = append(depInfo.EmbedFiles, filepath.Join(pkg.Dir, file))
+				}
+				if pkg.Module != nil {
+					depInfo.Packages = append(depInfo.Packages, ModulePackage{
+						ImportPath: pkgPath,
+						Dir:        pkg.Dir,
+						Native:     native,
+					})
+				}
+			}
+			depInfo.UsedBy = mergeStrings(depInfo.UsedBy, []string{rootPath})
+			if root.Module != nil {
+				depInfo.UsedByModules = mergeStrings(depInfo.UsedByModules, []string{root.Module.Path})
+			}
 		}
 	}
-	sort.Strings(deps)
-	return deps, nil
+	sort.Slice(depInfos, func(i, j int) bool {
+		return depInfos[i].ImportPath < depInfos[j].ImportPath
+	})
+	return depInfos, nil
 }
 
-// lists module dependencies
-// direct determines whether or not to list indirect dependencies
-func listModDependencies(includeIndirectDeps bool) ([]*PkgInfo, error) {
-	// Download all module dependencies into mod cache
-	args := []string{"mod", "download"}
-	cmd := exec.Command("go", args...)
-	out, err := cmd.CombinedOutput()
+// listNativeCode returns the native code of the packages of the build graph of
+// pkgs with cgo enabled, by import path. go list omits the cgo files when cgo
+// is disabled, which it is by default for cross targets or without a C
+// compiler, so they are read from this separate listing, only used to flag
+// native code: the reported dependencies remain the ones of the go command
+// default. It returns nil if cgo is enabled for the target, or if the user set
+// CGO_ENABLED, in which case the build graph itself is used.
+func listNativeCode(pkgs []string, target Target, flags []string, lo loadOptions) (map[string]*NativeCode, error) {
+	if lo.cgoSet() {
+		return nil, nil
+	}
+	out, err := lo.run(target, "env", "CGO_ENABLED")
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to download mod dependencies into mod cache")
+		return nil, err
 	}
-
-	// List all module dependencies
-	args = []string{"list", "-m","-f","{{.Path}}|{{.Version}}|{{.Indirect}}|{{.Dir}}","all"}
-	cmd = exec.Command("go", args...)
-	out, err = cmd.CombinedOutput()
-	output := string(out)
+	if strings.TrimSpace(string(out)) == "1" {
+		return nil, nil
+	}
+	lo.Env = append(append([]string{}, lo.Env...), "CGO_ENABLED=1")
+	listed, err := lo.listPackages(target, flags, pkgs)
 	if err != nil {
-		if strings.Contains(output, "cannot find package") ||
-			strings.Contains(output, "no buildable Go source files") {
-			return nil, &MissingError{Err: output}
+		return nil, errors.Wrap(err, "unable to list the native code of the dependencies")
+	}
+	natives := map[string]*NativeCode{}
+	for _, pkg := range listed {
+		natives[pkg.ImportPath] = nativeCode(pkg)
+	}
+	return natives, nil
+}
+
+// importChains returns the shortest import chain from one of the roots to
+// every package of the build graph, keyed by import path. Test variants are
+// named after the package they are a variant of, and generated test main
+// packages are omitted.
+func importChains(roots []*goListPackage, byImportPath map[string]*goListPackage) map[string][]string {
+	parents := map[string]string{}
+	var queue []string
+	for _, root := range roots {
+		if _, ok := parents[root.ImportPath]; !ok {
+			parents[root.ImportPath] = ""
+			queue = append(queue, root.ImportPath)
+		}
+	}
+	for len(queue) > 0 {
+		pkg := byImportPath[queue[0]]
+		queue = queue[1:]
+		if pkg == nil || pkg.Standard {
+			continue
+		}
+		for _, imp := range pkg.Imports {
+			if _, ok := parents[imp]; !ok {
+				parents[imp] = pkg.ImportPath
+				queue = append(queue, imp)
+			}
+		}
+	}
+	chains := map[string][]string{}
+	for importPath := range parents {
+		var chain []string
+		for p := importPath; p != ""; p = parents[p] {
+			pkgPath := strings.SplitN(p, " ", 2)[0]
+			if pkg := byImportPath[p]; pkg != nil && pkg.Name == "main" && strings.HasSuffix(pkgPath, ".test") {
+				continue
+			}
+			if len(chain) > 0 && chain[0] == pkgPath {
+				continue
+			}
+			chain = append([]string{pkgPath}, chain...)
 		}
-		return nil, fmt.Errorf("'go %s' failed with:\n%s",
-			strings.Join(args, " "), output)
+		chains[importPath] = chain
+	}
+	return chains
+}
+
+// listTargetsDependencies runs listModDependencies for every target and merges
+// the results, recording on each entry the targets it is built for. The
+// platform of the go command is used if no target is supplied.
+func listTargetsDependencies(pkgs []string, lo loadOptions) ([]*PkgInfo, error) {
+	if lo.Gopath == "" && !lo.Offline {
+		// Download all module dependencies into mod cache
+		if _, err := lo.run(Target{}, "mod", "download"); err != nil {
+			return nil, errors.Wrap(err, "unable to download mod dependencies into mod cache")
+		}
+	}
+	if len(lo.Targets) == 0 {
+		return listCategoriesDependencies(pkgs, Target{}, lo)
 	}
 	var depInfos []*PkgInfo
-	for _, dependency := range strings.Split(output, "\n"){
-		// {{.Path}}|{{.Version}}|{{.Indirect}}|{{.Dir}}
-		info :=  strings.Split(dependency, "|")
-		anyEmpty := false
-		for _, part := range info {
-			if len(part) == 0 {
-				anyEmpty = true
+	byImportPath := map[string]*PkgInfo{}
+	for _, target := range lo.Targets {
+		infos, err := listCategoriesDependencies(pkgs, target, lo)
+		if _, ok := err.(*MissingError); ok {
+			return nil, err
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list dependencies for target %s", target)
+		}
+		for _, info := range infos {
+			depInfo := byImportPath[info.ImportPath]
+			if depInfo == nil {
+				depInfo = info
+				byImportPath[info.ImportPath] = depInfo
+				depInfos = append(depInfos, depInfo)
+			} else {
+				mergeDepInfo(depInfo, info)
 			}
+			depInfo.Targets = append(depInfo.Targets, target.String())
 		}
-		if len(info) != 4 || anyEmpty {
-			continue
+	}
+	sort.Slice(depInfos, func(i, j int) bool {
+		return depInfos[i].ImportPath < depInfos[j].ImportPath
+	})
+	return depInfos, nil
+}
+
+const (
+	// CategoryRuntime is the category of dependencies linked into the analyzed packages
+	CategoryRuntime = "runtime"
+	// CategoryTool is the category of dependencies only used by tools, through
+	// tools.go files built with the "tools" tag or go.mod tool directives
+	CategoryTool = "tool"
+	// CategoryTestOnly is the category of dependencies only used by tests
+	CategoryTestOnly = "test-only"
+)
+
+// ValidateCategories returns an error if any of the categories is unknown.
+func ValidateCategories(categories []string) error {
+	for _, c := range categories {
+		switch c {
+		case CategoryRuntime, CategoryTool, CategoryTestOnly:
+		default:
+			return fmt.Errorf("%s is not a valid dependency category, expected one of %s, %s, %s",
+				c, CategoryRuntime, CategoryTool, CategoryTestOnly)
+		}
+	}
+	return nil
+}
+
+// ParseCategories returns the dependency categories listed in specs, such as
+// the values of a comma separated flag, skipping empty ones. It returns an
+// error if a category is unknown or none is listed, as nothing would be
+// reported.
+func ParseCategories(specs []string) ([]string, error) {
+	var categories []string
+	for _, spec := range specs {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			categories = append(categories, spec)
+		}
+	}
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("no dependency category to report, expected one or more of %s, %s, %s",
+			CategoryRuntime, CategoryTool, CategoryTestOnly)
+	}
+	return categories, ValidateCategories(categories)
+}
+
+// listCategoriesDependencies returns the dependencies of pkgs for the target,
+// classified in categories from the runtime, tool and test build graphs. A
+// dependency belongs to the first of these graphs it appears in. Only the
+// categories of lo.Categories are returned, runtime ones if it is empty.
+func listCategoriesDependencies(pkgs []string, target Target, lo loadOptions) ([]*PkgInfo, error) {
+	categories := map[string]bool{}
+	for _, c := range lo.Categories {
+		categories[c] = true
+	}
+	if len(categories) == 0 {
+		categories[CategoryRuntime] = true
+	}
+	infos, err := listModDependencies(pkgs, target, false, lo)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		info.Category = CategoryRuntime
+	}
+	if categories[CategoryTool] {
+		toolTarget := target
+		toolTarget.Tags = append(append([]string{}, target.Tags...), "tools")
+		toolPkgs := append([]string{}, pkgs...)
+		if lo.Gopath == "" {
+			taggedPkgs, err := listTaggedPackages(target, toolTarget, lo)
+			if err != nil {
+				return nil, err
+			}
+			toolPkgs = mergeStrings(toolPkgs, taggedPkgs)
 		}
-		indirectDep, err := strconv.ParseBool(info[2])
+		tools, err := listModTools(lo)
+		if err != nil {
+			return nil, err
+		}
+		if len(tools) > 0 {
+			toolPkgs = append(toolPkgs, "tool")
+		}
+		toolInfos, err := listModDependencies(toolPkgs, toolTarget, false, lo)
+		if err != nil {
+			return nil, err
+		}
+		infos = mergeCategory(infos, toolInfos, CategoryTool)
+	}
+	if categories[CategoryTestOnly] {
+		testInfos, err := listModDependencies(pkgs, target, true, lo)
 		if err != nil {
-			return nil, fmt.Errorf("cannot parse boolean in dependency: %s", dependency)
+			return nil, err
 		}
-		if indirectDep && !includeIndirectDeps {
+		infos = mergeCategory(infos, testInfos, CategoryTestOnly)
+	}
+	var kept []*PkgInfo
+	for _, info := range infos {
+		if categories[info.Category] {
+			kept = append(kept, info)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].ImportPath < kept[j].ImportPath
+	})
+	return kept, nil
+}
+
+// listTaggedPackages returns the first-party packages, not only the requested
+// ones, importing more packages for tagged, the target with the "tools" build
+// tag, than for target, such as the ones of tools.go files requiring tools.
+func listTaggedPackages(target, tagged Target, lo loadOptions) ([]string, error) {
+	patterns, err := defaultPatterns(lo)
+	if err != nil {
+		return nil, err
+	}
+	untaggedPkgs, err := lo.listPackages(target, target.buildFlags(), patterns)
+	if err != nil {
+		return nil, err
+	}
+	taggedPkgs, err := lo.listPackages(tagged, tagged.buildFlags(), patterns)
+	if err != nil {
+		return nil, err
+	}
+	imports := map[string][]string{}
+	for _, pkg := range untaggedPkgs {
+		if pkg.Error == nil {
+			imports[pkg.ImportPath] = pkg.Imports
+		}
+	}
+	var pkgs []string
+	for _, pkg := range taggedPkgs {
+		if pkg.Error == nil && len(mergeStrings(imports[pkg.ImportPath], pkg.Imports)) > len(imports[pkg.ImportPath]) {
+			pkgs = append(pkgs, pkg.ImportPath)
+		}
+	}
+	return pkgs, nil
+}
+
+// mergeCategory merges the dependencies of another build graph into infos,
+// classifying the ones it does not already contain in category.
+func mergeCategory(infos, others []*PkgInfo, category string) []*PkgInfo {
+	byImportPath := map[string]*PkgInfo{}
+	for _, info := range infos {
+		byImportPath[info.ImportPath] = info
+	}
+	for _, other := range others {
+		if info := byImportPath[other.ImportPath]; info != nil {
+			mergeDepInfo(info, other)
 			continue
 		}
-		depInfo := &PkgInfo{
-			Name: info[0],
-			Version: info[1],
-			ImportPath: info[0],
-			Root: info[3],
+		other.Category = category
+		byImportPath[other.ImportPath] = other
+		infos = append(infos, other)
+	}
+	return infos
+}
+
+// mergeDepInfo merges into info what other, describing the same dependency in
+// another build graph, records about its use, keeping the first category of
+// categoryRank among theirs.
+func mergeDepInfo(info, other *PkgInfo) {
+	if categoryRank(other.Category) < categoryRank(info.Category) {
+		info.Category = other.Category
+	}
+	info.UsedBy = mergeStrings(info.UsedBy, other.UsedBy)
+	info.UsedByModules = mergeStrings(info.UsedByModules, other.UsedByModules)
+	info.Packages = mergePackages(info.Packages, other.Packages)
+	info.Native = mergeNative(info.Native, other.Native)
+	info.EmbedFiles = mergeStrings(info.EmbedFiles, other.EmbedFiles)
+	if len(info.ImportChain) == 0 {
+		info.ImportChain = other.ImportChain
+	}
+}
+
+// goModFile mirrors the subset of `go mod edit -json` output used here.
+type goModFile struct {
+	Module struct {
+		Path string
+	}
+	Tool []struct {
+		Path string
+	}
+	Replace []struct {
+		Old, New struct {
+			Path, Version string
 		}
-		depInfos = append(depInfos, depInfo)
 	}
-	return depInfos, nil
+}
+
+// readGoMod returns the go.mod file of the module in lo.Dir, nil outside of a
+// module, such as in a workspace root, or in GOPATH mode.
+func readGoMod(lo loadOptions) (*goModFile, error) {
+	if lo.Gopath != "" {
+		return nil, nil
+	}
+	out, err := lo.run(Target{}, "mod", "edit", "-json")
+	if err != nil {
+		// outside of a module
+		return nil, nil
+	}
+	goMod := &goModFile{}
+	if err := json.Unmarshal(out, goMod); err != nil {
+		return nil, errors.Wrap(err, "unable to decode go.mod")
+	}
+	return goMod, nil
+}
+
+// listModTools returns the packages declared by the tool directives of the
+// main module's go.mod, if any.
+func listModTools(lo loadOptions) ([]string, error) {
+	goMod, err := readGoMod(lo)
+	if err != nil || goMod == nil {
+		return nil, err
+	}
+	var tools []string
+	for _, tool := range goMod.Tool {
+		tools = append(tools, tool.Path)
+	}
+	return tools, nil
+}
+
+// mergeStrings returns a with the elements of b it does not contain appended.
+func mergeStrings(a, b []string) []string {
+	seen := map[string]bool{}
+	for _, s := range a {
+		seen[s] = true
+	}
+	for _, s := range b {
+		if !seen[s] {
+			seen[s] = true
+			a = append(a, s)
+		}
+	}
+	return a
+}
+
+// mergePackages returns a with the packages of b it does not contain appended.
+func mergePackages(a, b []ModulePackage) []ModulePackage {
+	seen := map[string]bool{}
+	for _, pkg := range a {
+		seen[pkg.ImportPath] = true
+	}
+	for _, pkg := range b {
+		if !seen[pkg.ImportPath] {
+			seen[pkg.ImportPath] = true
+			a = append(a, pkg)
+		}
+	}
+	return a
+}
+
+// newDepInfo returns the PkgInfo describing the module containing pkg, or pkg
+// itself when it does not belong to a module. In module mode, packages which
+// could not be attributed to a module, and modules without a directory, are
+// reported as not available.
+func newDepInfo(pkg *goListPackage, moduleMode bool) *PkgInfo {
+	if pkg.Module == nil {
+		importPath := strings.SplitN(pkg.ImportPath, " ", 2)[0]
+		name := pkg.Name
+		if pkg.Error != nil && name == "" {
+			name = importPath
+		}
+		pkgErr := pkg.Error
+		if moduleMode && pkgErr != nil {
+			pkgErr = &PkgError{Err: "not available: " + pkgErr.Err}
+		}
+		return &PkgInfo{
+			Name:       name,
+			Dir:        pkg.Dir,
+			Root:       pkg.Root,
+			ImportPath: importPath,
+			Error:      pkgErr,
+		}
+	}
+	return newModuleInfo(pkg.Module)
+}
+
+// newModuleInfo returns the entry of a module, with an error if it is missing
+// from the module cache.
+func newModuleInfo(mod *goListModule) *PkgInfo {
+	info := &PkgInfo{
+		Name:       mod.Path,
+		Dir:        mod.Dir,
+		Root:       mod.Dir,
+		ImportPath: mod.Path,
+		Version:    mod.Version,
+	}
+	// the module directory is the one of its replacement, if any
+	if mod.Replace != nil {
+		info.ReplacePath = mod.Replace.Path
+		info.ReplaceVersion = mod.Replace.Version
+	}
+	if mod.Error != nil {
+		info.Error = &PkgError{Err: "not available: " + mod.Error.Err}
+	} else if mod.Dir == "" {
+		info.Error = &PkgError{Err: fmt.Sprintf("not available: %s@%s is missing from the module cache",
+			mod.Path, mod.Version)}
+	}
+	return info
 }
 
 type PkgError struct {
 	Err string
 }
 
+// ModulePackage is a package of a module imported by the analyzed packages.
+type ModulePackage struct {
+	ImportPath string
+	Dir        string
+	// Native is the native code of the package, if any
+	Native *NativeCode
+}
+
 type PkgInfo struct {
 	Name       string
 	Dir        string
@@ -164,17 +749,125 @@ type PkgInfo struct {
 	ImportPath string
 	Version    string
 	Error      *PkgError
+	// ReplacePath and ReplaceVersion identify the module replacing this one, if
+	// any. ReplaceVersion is empty for local directories.
+	ReplacePath    string
+	ReplaceVersion string
+	// Sum is the hash of the module files recorded in the build information
+	// of binaries, go.sum is used to verify the other modules
+	Sum string
+	// UsedBy lists the requested packages whose build graph includes this entry
+	UsedBy []string
+	// UsedByModules lists the first-party modules of the requested packages
+	UsedByModules []string
+	// Packages lists the imported packages of the module, if known
+	Packages []ModulePackage
+	// Category is one of CategoryRuntime, CategoryTool and CategoryTestOnly, if known
+	Category string
+	// Targets lists the targets whose build graph includes this entry, if any were requested
+	Targets []string
+	// IntroducedBy lists the direct dependencies of the main modules requiring
+	// this module, itself if it is one, and Depth is its minimum depth in the
+	// module graph, 1 for direct dependencies, if known
+	IntroducedBy []string
+	Depth        int
+	// ImportChain is the shortest import chain from a requested package to a
+	// package of this entry, if known
+	ImportChain []string
+	// Native is the native code of the imported packages, if any
+	Native *NativeCode
+	// EmbedFiles lists the paths of the files embedded by the imported
+	// packages with //go:embed
+	EmbedFiles []string
+}
+
+// listMainPackages returns the import paths of the main packages matched by
+// the supplied package patterns, every first-party package if none is supplied.
+func listMainPackages(lo loadOptions, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		var err error
+		patterns, err = defaultPatterns(lo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pkgs, err := lo.listPackages(Target{}, nil, patterns)
+	if err != nil {
+		return nil, err
+	}
+	var mains []string
+	for _, pkg := range pkgs {
+		if pkg.Name == "main" {
+			mains = append(mains, pkg.ImportPath)
+		}
+	}
+	return mains, nil
 }
 
 type Options struct {
-	RunAll                  bool
-	Words                   bool
-	PrintConfidence         bool
-	UseCsv                  bool
-	UseMarkdown             bool
-	IncludeIndirectDeps     bool
-	PrunePath               string
-	HelperListGlooPkgs      bool
+	RunAll          bool
+	Words           bool
+	PrintConfidence bool
+	UseCsv          bool
+	UseMarkdown     bool
+	// IncludeIndirectDeps includes modules marked as indirect in go.mod
+	IncludeIndirectDeps bool
+	PrunePath           string
+	// IncludeStd adds an entry for the Go runtime and standard library, with
+	// the version of the go command and the text of $GOROOT/LICENSE and PATENTS
+	IncludeStd bool
+	// ListBinaries only prints the main packages matched by Pkgs
+	ListBinaries bool
+	// Deprecated: use ListBinaries
+	HelperListGlooPkgs bool
+	// PerBinary treats Pkgs as patterns ("./..." if empty) and prints one report
+	// per main package they match, followed by a report of their union
+	PerBinary bool
+	// Targets are the platforms and build tags to analyze, the platform of the go command if empty
+	Targets []Target
+	// Binaries are built executables whose embedded module list is analyzed instead of Pkgs
+	Binaries []string
+	// Vendor analyzes the modules listed in vendor/modules.txt instead of Pkgs
+	Vendor bool
+	// Dir is the directory the packages are analyzed in, the current one if empty
+	Dir string
+	// GoCommand is the path of the go command, "go" from PATH if empty
+	GoCommand string
+	// Env lists KEY=value variables overriding the process environment of the
+	// go command, such as GOFLAGS, GOMODCACHE, GOPRIVATE, GOTOOLCHAIN, GOOS or GOARCH
+	Env []string
+	// GoMod analyzes the modules required by this go.mod file instead of Pkgs,
+	// without the source tree of its module
+	GoMod string
+	// GoSum is the go.sum file of GoMod, the one next to it by default
+	GoSum string
+	// Evaluate analyzes the modules that requiring this module@version would
+	// add to the build list instead of Pkgs, without modifying go.mod
+	Evaluate string
+	// Monorepo analyzes every module whose go.mod is under this directory
+	// instead of Pkgs, in a single report
+	Monorepo string
+	// Offline never downloads modules nor modifies go.mod and go.sum, modules
+	// missing from the module cache are reported as not available
+	Offline bool
+	// ProxyFallback downloads from GOPROXY the license files of the modules
+	// missing from the module cache, or without one there, even offline
+	ProxyFallback bool
+	// Verify compares the files the licenses of the modules are read from with
+	// their go.sum hashes, reporting mismatches as error diagnostics
+	Verify bool
+	// Categories are the dependency categories to report, among
+	// CategoryRuntime, CategoryTool and CategoryTestOnly, runtime ones if empty
+	Categories []string
+	// ImportChains adds the shortest import chain from a requested package to
+	// every dependency to the report
+	ImportChains bool
+	// FailOn fails the run once the report is printed if a dependency has a
+	// diagnostic of this severity or above, never if SeverityNone
+	FailOn Severity
+	// Tree prints the module requirement graph with the license of every
+	// reported module after the report
+	Tree                    bool
 	ConsolidatedLicenseFile string
 	Pkgs                    []string
 	Product                 Product
@@ -192,53 +885,496 @@ the package directory, and its parent directories until one is found. Files
 content is matched against a set of well-known licenses and the best match is
 displayed along with its score.
 
-With -a, all individual packages are displayed instead of grouping them by
-license files.
+With -a, all individual imported packages are displayed instead of modules,
+each with the license file closest to it in its module. Without it, packages
+under a license file nested in their module are grouped in an entry named
+after its directory.
 With -w, words in package license file not found in the template license are
 displayed. It helps assessing the changes importance.
+With -per-binary, every main package matched by the arguments (./... if none)
+gets its own report, followed by a report covering all of them.
+With -binaries, the arguments are built executables and the modules recorded
+in their build information are analyzed, using the module cache.
+With -categories, dependencies only used by tests (test-only) or by tools
+(tool) can be reported in addition to, or instead of, runtime ones.
+With -tree, the module requirement graph is printed after the report, with
+the license of every reported module, to find the direct dependency pulling
+in a module.
+With -dir, -go and -env, the packages of another directory are analyzed with
+another go command and environment, such as GOFLAGS, GOMODCACHE or GOOS.
+With -evaluate module@version, the modules requiring it would add to the build
+list of the current module, resolved through GOPROXY, are analyzed without
+modifying its go.mod and go.sum files.
+With -gomod, the modules required by a go.mod file, with its go.sum file if
+any, are analyzed without the source tree of its module.
+With -monorepo, every module under a directory is analyzed on its own, and
+the dependencies of all of them are reported once, with the modules using them.
+Dependencies which cannot be analyzed are reported with diagnostics, and the
+analysis goes on. With -fail-on, diagnostics of a severity fail the run.
+With -vendor, the modules vendored according to vendor/modules.txt are
+analyzed, without arguments and without using the module cache.
 
 Wrap PrintLicensesWithOptions with a go script if you would like to implement the Product interface.
 The Product interface allows you to append or skip licenses.`)
 		os.Exit(1)
 	}
-	flag.BoolVar(&opts.RunAll, "a", false, "display all individual packages")
+	flag.BoolVar(&opts.RunAll, "a", false, "display all individual packages instead of modules")
 	flag.BoolVar(&opts.Words, "w", false, "display words not matching license template")
 	flag.BoolVar(&opts.PrintConfidence, "print-confidence", false, "display confidence level (default false)")
 	flag.BoolVar(&opts.UseCsv, "csv", false, "print in csv format (default false)")
 	flag.BoolVar(&opts.UseMarkdown, "markdown", false, "print in markdown table format (default false)")
 	flag.StringVar(&opts.PrunePath, "prune-path", "", "prefix path to remove from the package and file specs during display output, ex: 'github.com/solo-io/gloo/vendor/'")
-	flag.BoolVar(&opts.HelperListGlooPkgs, "helper-list-gloo-pkgs", false, "if set, will just print the list of packages concerning Gloo")
+	flag.BoolVar(&opts.ListBinaries, "list-binaries", false, "if set, will just print the main packages matched by the arguments (default ./...)")
+	flag.BoolVar(&opts.PerBinary, "per-binary", false, "print one report per main package matched by the arguments (default ./...), then one for all of them")
 	flag.StringVar(&opts.ConsolidatedLicenseFile, "consolidated-license-file", "", "if set, will write all of the licenses' text to this file")
-	opts.Pkgs = flag.Args()
+	flag.BoolVar(&opts.Offline, "offline", false, "never download modules nor modify go.mod/go.sum, report modules missing from the module cache as not available")
+	flag.BoolVar(&opts.Verify, "verify", false, "compare the files of the modules with their go.sum hashes before reading their licenses, reporting mismatches as errors")
+	flag.BoolVar(&opts.ProxyFallback, "proxy-fallback", false, "download from GOPROXY the license files of the modules missing from the module cache, or without one there, even with -offline")
+	flag.BoolVar(&opts.IncludeStd, "include-std", false, "also report the Go runtime and standard library, with the version of the go command, or the one binaries were built with, and the text of $GOROOT/LICENSE and PATENTS")
+	flag.BoolVar(&opts.IncludeIndirectDeps, "include-indirect", false, "also report dependencies marked as indirect in go.mod, annotated with the direct dependencies introducing them")
+	flag.BoolVar(&opts.ImportChains, "import-chains", false, "display the shortest import chain from the analyzed packages to every dependency")
+	flag.BoolVar(&opts.Tree, "tree", false, "print the module requirement graph with the license of every reported module")
+	flag.StringVar(&opts.Dir, "dir", "", "directory to analyze the packages in (default: the current directory)")
+	flag.StringVar(&opts.GoCommand, "go", "", "path of the go command (default: go from PATH)")
+	flag.Var((*stringsFlag)(&opts.Env), "env", "KEY=value variable of the go command environment, ex: 'GOFLAGS=-mod=mod', may be repeated")
+	flag.StringVar(&opts.Evaluate, "evaluate", "", "analyze the modules requiring this module@version would add, without modifying go.mod, instead of packages")
+	flag.StringVar(&opts.GoMod, "gomod", "", "analyze the modules required by this go.mod file, without the source tree of its module, instead of packages")
+	flag.StringVar(&opts.GoSum, "gosum", "", "go.sum file of the -gomod file (default: the go.sum file next to it)")
+	flag.StringVar(&opts.Monorepo, "monorepo", "", "analyze every module whose go.mod is under this directory, skipping vendor and testdata directories, instead of packages")
+	flag.BoolVar(&opts.Vendor, "vendor", false, "analyze the modules listed in vendor/modules.txt instead of packages")
+	binaries := flag.Bool("binaries", false, "analyze the modules embedded in the executables passed as arguments")
+	failOn := flag.String("fail-on", "none", "fail if a dependency has a diagnostic of this severity or above, among none, info, warning and error")
+	categories := flag.String("categories", CategoryRuntime, "comma separated dependency categories to report, among runtime, tool and test-only")
+	targets := flag.String("targets", "", "comma separated goos/goarch[+tag...] targets to analyze, ex: 'linux/amd64,linux/arm64+enterprise' (default: the current platform)")
+	flag.Parse()
+	if *targets != "" {
+		var err error
+		opts.Targets, err = ParseTargets(strings.Split(*targets, ","))
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	opts.Categories, err = ParseCategories(strings.Split(*categories, ","))
+	if err != nil {
+		return err
+	}
+	severity, err := ParseSeverity(*failOn)
+	if err != nil {
+		return err
+	}
+	opts.FailOn = severity
+	if *binaries {
+		opts.Binaries = flag.Args()
+	} else {
+		opts.Pkgs = flag.Args()
+	}
 	opts.Product = &genericProduct{}
 	return PrintLicensesWithOptions(opts)
 
 }
+
+// stringsFlag is a flag.Value collecting the values of a repeated flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// loadOptions returns the options loading the packages to analyze.
+func (opts *Options) loadOptions() loadOptions {
+	return loadOptions{
+		Dir:                 opts.Dir,
+		GoCommand:           opts.GoCommand,
+		Env:                 opts.Env,
+		Targets:             opts.Targets,
+		IncludeIndirectDeps: opts.IncludeIndirectDeps,
+		Offline:             opts.Offline,
+		ProxyFallback:       opts.ProxyFallback,
+		Verify:              opts.Verify,
+		PerPackage:          opts.RunAll,
+		Categories:          opts.Categories,
+	}
+}
+
 func PrintLicensesWithOptions(opts *Options) error {
-	if opts.HelperListGlooPkgs {
-		printGlooPkgNames()
+	if err := ValidateCategories(opts.Categories); err != nil {
+		return err
+	}
+	if err := validateEnv(opts.Env); err != nil {
+		return err
+	}
+	lo := opts.loadOptions()
+	if opts.ListBinaries || opts.HelperListGlooPkgs {
+		mains, err := listMainPackages(lo, opts.Pkgs)
+		if err != nil {
+			return err
+		}
+		// print in the form expected by the main license check - you can paste this result into the arguments list
+		fmt.Println(strings.Join(mains, " "))
 		return nil
 	}
-	replacer := getPathReplacer(opts.Product.ReplacementList())
-	if len(opts.Pkgs) < 1 {
-		return fmt.Errorf("expect at least one package argument")
+	var licenses []License
+	var pkgs []string
+	var err error
+	if opts.Tree && (len(opts.Binaries) > 0 || opts.Vendor || opts.Monorepo != "" || opts.GoMod != "" || opts.Evaluate != "") {
+		return fmt.Errorf("the dependency tree is only supported for packages")
+	}
+	if opts.Tree && opts.UseCsv {
+		return fmt.Errorf("the dependency tree is not supported in csv format")
+	}
+	// the standard library is linked into every binary, with the version of the
+	// go command unless they were already built
+	goVersions := map[string][]string{}
+	var graph *modGraph
+	if len(opts.Binaries) > 0 {
+		pkgs = opts.Binaries
+		licenses, goVersions, err = listBinaryLicenses(opts.Binaries, lo)
+	} else if opts.Evaluate != "" {
+		if opts.PerBinary {
+			return fmt.Errorf("per binary reports are not supported when evaluating a module")
+		}
+		if opts.IncludeStd {
+			return fmt.Errorf("the standard library is not reported when evaluating a module")
+		}
+		licenses, err = listCandidateLicenses(opts.Evaluate, lo)
+	} else if opts.GoMod != "" {
+		if opts.PerBinary {
+			return fmt.Errorf("per binary reports are not supported for go.mod files")
+		}
+		licenses, err = listModFileLicenses(opts.GoMod, opts.GoSum, lo)
+	} else if opts.Monorepo != "" {
+		if opts.PerBinary {
+			return fmt.Errorf("per binary reports are not supported for monorepos")
+		}
+		licenses, err = listMonorepoLicenses(opts.Monorepo, lo)
+	} else if opts.Vendor {
+		if opts.PerBinary {
+			return fmt.Errorf("per binary reports are not supported for vendored modules")
+		}
+		dir := opts.Dir
+		if dir == "" {
+			dir = "."
+		}
+		licenses, err = listVendorLicenses(dir, lo)
+	} else {
+		pkgs = opts.Pkgs
+		if opts.PerBinary {
+			pkgs, err = listMainPackages(lo, pkgs)
+			if err != nil {
+				return err
+			}
+		}
+		if len(pkgs) < 1 {
+			return fmt.Errorf("expect at least one package argument")
+		}
+		licenses, graph, err = listLicensesAndGraph(pkgs, lo, lo.IncludeIndirectDeps || opts.Tree)
 	}
-
-	confidence := 0.7
-	licenses, err := listLicenses(opts.Pkgs, opts.IncludeIndirectDeps)
 	if err != nil {
 		return err
 	}
+	if opts.IncludeStd {
+		if len(goVersions) == 0 {
+			goVersions[""] = pkgs
+		}
+		var versions []string
+		for version := range goVersions {
+			versions = append(versions, version)
+		}
+		sort.Strings(versions)
+		for _, version := range versions {
+			std, err := stdLicense(lo, version)
+			if err != nil {
+				return err
+			}
+			std.UsedBy = goVersions[version]
+			licenses = append(licenses, std)
+		}
+	}
+	if opts.PerBinary {
+		for _, pkg := range pkgs {
+			if _, err := printReport(opts, pkg, licensesUsedBy(licenses, pkg), false); err != nil {
+				return err
+			}
+		}
+	}
+	title := ""
+	if opts.PerBinary {
+		title = "all binaries"
+	}
+	includedLicenses, err := printReport(opts, title, licenses, true)
+	if err != nil {
+		return err
+	}
+	if opts.Tree {
+		if err := printDependencyTree(opts, graph, licenses); err != nil {
+			return err
+		}
+	}
+	if opts.ConsolidatedLicenseFile != "" {
+		if err := writeConsolidatedLicenseFile(opts.ConsolidatedLicenseFile, includedLicenses); err != nil {
+			return fmt.Errorf("unable to write consolidated license file %v", err)
+		}
+	}
+	return failingDiagnostics(licenses, opts.Product, opts.FailOn)
+}
+
+// licensesUsedBy returns the licenses of the dependencies pulled in by pkg.
+func licensesUsedBy(licenses []License, pkg string) []License {
+	var kept []License
+	for _, l := range licenses {
+		for _, usedBy := range l.UsedBy {
+			if usedBy == pkg {
+				kept = append(kept, l)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// printReportTitle prints the heading introducing a report when several are
+// printed in a row.
+func printReportTitle(opts *Options, title string) error {
+	var err error
+	switch {
+	case opts.UseCsv:
+		// csv rows carry the report title in their first column
+	case opts.UseMarkdown:
+		_, err = fmt.Fprintf(os.Stdout, "\n## %s\n\n", title)
+	default:
+		_, err = fmt.Fprintf(os.Stdout, "\n== %s ==\n", title)
+	}
+	return err
+}
+
+// reportColumn is an optional column appended to the report rows.
+type reportColumn struct {
+	Header string
+	Values func(l License) []string
+}
+
+// reportColumns returns the optional columns relevant to the licenses, in
+// this order:
+//   - the targets they are built for, if targets were requested
+//   - their category, if several categories were requested
+//   - the modules replacing them, if any
+//   - the parent modules their license is inherited from, if any
+//   - the direct dependencies introducing them and their depth, if some are
+//     transitive
+//   - the import chains pulling them in, if requested
+//   - the native code they link or bundle, if any
+//   - the files they embed, if any
+//   - their diagnostics, if any
+//   - the first-party modules using them, if they span several modules, such
+//     as in a workspace
+func reportColumns(opts *Options, licenses []License) []reportColumn {
+	var columns []reportColumn
+	if len(opts.Targets) > 0 {
+		columns = append(columns, reportColumn{
+			Header: "Targets",
+			Values: func(l License) []string { return l.Targets },
+		})
+	}
+	if len(opts.Categories) > 1 {
+		columns = append(columns, reportColumn{
+			Header: "Category",
+			Values: func(l License) []string { return []string{l.Category} },
+		})
+	}
+	for _, l := range licenses {
+		if l.ReplacePath != "" {
+			columns = append(columns, reportColumn{
+				Header: "Replaced By",
+				Values: func(l License) []string {
+					if l.ReplacePath == "" {
+						return nil
+					}
+					return []string{strings.TrimSpace(l.ReplacePath + " " + l.ReplaceVersion)}
+				},
+			})
+			break
+		}
+	}
+	for _, l := range licenses {
+		if l.InheritedFrom != "" {
+			columns = append(columns, reportColumn{
+				Header: "License From",
+				Values: func(l License) []string {
+					if l.InheritedFrom == "" {
+						return nil
+					}
+					return []string{l.InheritedFrom}
+				},
+			})
+			break
+		}
+	}
+	for _, l := range licenses {
+		if l.Depth > 1 {
+			columns = append(columns, reportColumn{
+				Header: "Introduced By",
+				Values: func(l License) []string { return l.IntroducedBy },
+			}, reportColumn{
+				Header: "Depth",
+				Values: func(l License) []string {
+					if l.Depth == 0 {
+						return nil
+					}
+					return []string{strconv.Itoa(l.Depth)}
+				},
+			})
+			break
+		}
+	}
+	if opts.ImportChains {
+		columns = append(columns, reportColumn{
+			Header: "Import Chain",
+			Values: func(l License) []string {
+				if len(l.ImportChain) == 0 {
+					return nil
+				}
+				return []string{strings.Join(l.ImportChain, " > ")}
+			},
+		})
+	}
+	for _, l := range licenses {
+		if l.Native != nil {
+			columns = append(columns, reportColumn{
+				Header: "Native Code",
+				Values: func(l License) []string {
+					if l.Native == nil {
+						return nil
+					}
+					var values []string
+					if len(l.Native.Libraries) > 0 {
+						values = append(values, "links "+strings.Join(l.Native.Libraries, ", "))
+					}
+					if len(l.Native.Sources) > maxReportedFiles {
+						values = append(values, fmt.Sprintf("bundles %d files", len(l.Native.Sources)))
+					} else if len(l.Native.Sources) > 0 {
+						values = append(values, "bundles "+strings.Join(l.Native.Sources, ", "))
+					}
+					return append(values, l.Native.Notices...)
+				},
+			})
+			break
+		}
+	}
+	for _, l := range licenses {
+		if len(l.Embedded) > 0 {
+			columns = append(columns, reportColumn{
+				Header: "Embedded",
+				Values: func(l License) []string {
+					if len(l.Embedded) > maxReportedFiles {
+						return []string{fmt.Sprintf("%d files", len(l.Embedded))}
+					}
+					return l.Embedded
+				},
+			})
+			break
+		}
+	}
+	for _, l := range licenses {
+		if len(l.Diagnostics) > 0 {
+			columns = append(columns, reportColumn{
+				Header: "Diagnostics",
+				Values: func(l License) []string {
+					var values []string
+					for _, d := range l.Diagnostics {
+						values = append(values, d.String())
+					}
+					return values
+				},
+			})
+			break
+		}
+	}
+	var modules []string
+	for _, l := range licenses {
+		modules = mergeStrings(modules, l.UsedByModules)
+	}
+	if len(modules) > 1 {
+		columns = append(columns, reportColumn{
+			Header: "Used By",
+			Values: func(l License) []string { return l.UsedByModules },
+		})
+	}
+	return columns
+}
+
+// printDependencyTree prints the module requirement graph with the license of
+// every reported module.
+func printDependencyTree(opts *Options, graph *modGraph, licenses []License) error {
+	if graph == nil {
+		return fmt.Errorf("the dependency tree requires the module graph, which could not be loaded")
+	}
+	titles := map[string]string{}
+	for _, l := range licenses {
+		if _, ok := titles[l.Package]; ok || opts.Product.SkipLicense(l) {
+			continue
+		}
+		title := "?"
+		switch {
+		case l.Template != nil && l.Score >= 0.7:
+			title = l.Template.Title
+		case l.Template != nil:
+			title = "UNKNOWN"
+		case l.Err != "":
+			title = strings.Replace(l.Err, "\n", " ", -1)
+		}
+		titles[l.Package] = opts.Product.OverrideLicense(l.Package, title)
+	}
+	if err := printReportTitle(opts, "dependency tree"); err != nil {
+		return err
+	}
+	if opts.UseMarkdown {
+		fmt.Fprintln(os.Stdout, "```")
+	}
+	if err := graph.printTree(os.Stdout, titles); err != nil {
+		return err
+	}
+	if opts.UseMarkdown {
+		fmt.Fprintln(os.Stdout, "```")
+	}
+	return nil
+}
+
+// printReport prints the licenses in the format selected by opts and returns
+// the licenses matched with enough confidence to be included in the
+// consolidated license file. Product extra licenses are only added if
+// withExtras is set.
+func printReport(opts *Options, title string, licenses []License, withExtras bool) ([]License, error) {
+	replacer := getPathReplacer(opts.Product.ReplacementList())
+	confidence := 0.7
+	var err error
 	if !opts.RunAll {
 		licenses, err = groupLicenses(licenses)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+	if withExtras {
+		licenses = append(licenses, opts.Product.ExtraLicenses()...)
+	}
+	if title != "" {
+		if err := printReportTitle(opts, title); err != nil {
+			return nil, err
 		}
 	}
-	licenses = append(licenses, opts.Product.ExtraLicenses()...)
 	w := tabwriter.NewWriter(os.Stdout, 1, 4, 2, ' ', 0)
 	csvW := csv.NewWriter(os.Stdout)
-	mdW := markdown.NewWriter(os.Stdout, []string{"Name", "Version", "License"})
+	columns := reportColumns(opts, licenses)
+	mdHeaders := []string{"Name", "Version", "License"}
+	for _, c := range columns {
+		mdHeaders = append(mdHeaders, c.Header)
+	}
+	mdW := markdown.NewWriter(os.Stdout, mdHeaders)
 	var includedLicenses []License
 	for _, l := range licenses {
 		license := "?"
@@ -274,7 +1410,10 @@ func PrintLicensesWithOptions(opts *Options) error {
 		if pathString == "" {
 			pathString = getPathString(l.Path, opts.PrunePath, replacer)
 		}
-		version := getVersion(pathString)
+		version := l.Version
+		if version == "" {
+			version = getVersion(pathString)
+		}
 		if opts.PrunePath != "" {
 			packageString = strings.TrimPrefix(packageString, opts.PrunePath)
 		}
@@ -289,37 +1428,49 @@ func PrintLicensesWithOptions(opts *Options) error {
 		}
 
 		if opts.UseCsv {
-			err = csvW.Write([]string{packageString, version, pathString, license})
+			record := []string{packageString, version, pathString, license}
+			if title != "" {
+				record = append([]string{title}, record...)
+			}
+			for _, c := range columns {
+				record = append(record, strings.Join(c.Values(l), " "))
+			}
+			err = csvW.Write(record)
 		} else if opts.UseMarkdown {
 			mdPackageLink := getMarkdownPackageLink(packageString)
-			err = mdW.Write([]string{mdPackageLink, version, license})
+			record := []string{mdPackageLink, version, license}
+			for _, c := range columns {
+				record = append(record, strings.Join(c.Values(l), ", "))
+			}
+			err = mdW.Write(record)
 		} else {
-			_, err = w.Write([]byte(packageString + "\t" + license + "\n"))
+			line := packageString + "\t" + license
+			for _, c := range columns {
+				line += "\t" + strings.Join(c.Values(l), ", ")
+			}
+			_, err = w.Write([]byte(line + "\n"))
 		}
 		if err != nil {
-			return err
-		}
-	}
-	if opts.ConsolidatedLicenseFile != "" {
-		if err := writeConsolidatedLicenseFile(opts.ConsolidatedLicenseFile, includedLicenses); err != nil {
-			return fmt.Errorf("unable to write consolidated license file %v", err)
+			return nil, err
 		}
 	}
 	if opts.UseCsv {
 		csvW.Flush()
-		return nil
+		return includedLicenses, csvW.Error()
 	}
 	if opts.UseMarkdown {
-		mdW.Flush()
-		return nil
+		return includedLicenses, mdW.Flush()
 	}
 	if err := w.Flush(); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return includedLicenses, nil
 }
 
 func getMarkdownPackageLink(packageString string) string {
+	if packageString == StdPackage {
+		return fmt.Sprintf("[%s](https://pkg.go.dev/std)", packageString)
+	}
 	parts := strings.Split(packageString, "/")
 	var shortPkgName string
 	// get last two parts of package string for descriptive package name
@@ -1,10 +1,21 @@
 package license
 
 import (
+	"archive/zip"
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/mod/sumdb/dirhash"
 )
 
 type testResult struct {
@@ -21,7 +32,7 @@ func listTestLicenses(pkgs []string) ([]testResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	licenses, err := listLicenses(gopath, pkgs)
+	licenses, err := listLicenses(pkgs, loadOptions{Gopath: gopath, IncludeIndirectDeps: true})
 	if err != nil {
 		return nil, err
 	}
@@ -125,6 +136,50 @@ func TestMainWithAliasedDependencies(t *testing.T) {
 	}
 }
 
+func TestPerBinary(t *testing.T) {
+	gopath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lo := loadOptions{Gopath: gopath}
+	mains, err := listMainPackages(lo, []string{"colors/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(mains, " ") != "colors/cmd/mix colors/cmd/paint" {
+		t.Fatalf("unexpected main packages: %v", mains)
+	}
+	licenses, err := listLicenses(mains, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packages := func(licenses []License) string {
+		var names []string
+		for _, l := range licenses {
+			names = append(names, l.Package)
+		}
+		return strings.Join(names, " ")
+	}
+	// both binaries depend on colors/red
+	wanted := map[string]string{
+		"colors/cmd/mix":   "colors/cmd/mix colors/red couleurs/red",
+		"colors/cmd/paint": "colors/cmd/paint colors/red",
+	}
+	for _, main := range mains {
+		if got := packages(licensesUsedBy(licenses, main)); got != wanted[main] {
+			t.Errorf("unexpected dependencies of %s: %s != %s", main, got, wanted[main])
+		}
+	}
+	// the binaries share the license of colors/cmd in the union report
+	included, err := printReport(&Options{Product: &genericProduct{}}, "all binaries", licenses, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := packages(included); got != "colors/cmd colors/red couleurs/red" {
+		t.Errorf("unexpected union report: %s", got)
+	}
+}
+
 func TestMissingPackage(t *testing.T) {
 	_, err := listTestLicenses([]string{"colors/missing"})
 	if err == nil {
@@ -212,3 +267,1361 @@ func TestStandardPackages(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget("linux/arm64+enterprise+fips")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.GOOS != "linux" || target.GOARCH != "arm64" ||
+		strings.Join(target.Tags, ",") != "enterprise,fips" {
+		t.Fatalf("unexpected target: %+v", target)
+	}
+	if target.String() != "linux/arm64+enterprise+fips" {
+		t.Fatalf("unexpected target name: %s", target)
+	}
+	for _, invalid := range []string{"linux", "linux/", "/amd64", "linux/amd64+"} {
+		if _, err := ParseTarget(invalid); err == nil {
+			t.Fatalf("no error on invalid target %q", invalid)
+		}
+	}
+}
+
+func TestTargetsDependencies(t *testing.T) {
+	gopath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// colors/brown only imports colors/red on linux
+	infos, err := listTargetsDependencies([]string{"colors/brown"}, loadOptions{
+		Gopath:  gopath,
+		Targets: []Target{{GOOS: "linux", GOARCH: "amd64"}, {GOOS: "darwin", GOARCH: "arm64"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, info := range infos {
+		got = append(got, fmt.Sprintf("%s %v", info.ImportPath, info.Targets))
+	}
+	wanted := []string{
+		"colors/brown [linux/amd64 darwin/arm64]",
+		"colors/red [linux/amd64]",
+	}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("targets do not match:\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestTargetsCategory(t *testing.T) {
+	gopath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// colors/red is only imported by the tests of colors/brown on darwin
+	infos, err := listTargetsDependencies([]string{"colors/brown"}, loadOptions{
+		Gopath:     gopath,
+		Targets:    []Target{{GOOS: "darwin", GOARCH: "arm64"}, {GOOS: "linux", GOARCH: "amd64"}},
+		Categories: []string{CategoryRuntime, CategoryTestOnly},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, info := range infos {
+		got = append(got, fmt.Sprintf("%s %s %v", info.ImportPath, info.Category, info.Targets))
+	}
+	wanted := []string{
+		"colors/brown runtime [darwin/arm64 linux/amd64]",
+		"colors/red runtime [darwin/arm64 linux/amd64]",
+	}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("categories do not match:\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestEnvTargets(t *testing.T) {
+	opts := &CliOptions{Targets: []string{"linux/amd64"}, Env: []string{"GOPRIVATE=example.com", "GOOS=darwin"}}
+	if err := envTargets(opts, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.Targets) != 0 {
+		t.Fatalf("expected the default target to be replaced by GOOS, got %v", opts.Targets)
+	}
+	opts = &CliOptions{Targets: []string{"linux/arm64"}, Env: []string{"GOARCH=amd64"}}
+	if err := envTargets(opts, true); err == nil {
+		t.Fatal("expected GOARCH to conflict with --targets")
+	}
+	opts = &CliOptions{Targets: []string{"linux/arm64"}, Env: []string{"GOFLAGS=-mod=mod"}}
+	if err := envTargets(opts, true); err != nil || len(opts.Targets) != 1 {
+		t.Fatalf("unexpected targets %v: %v", opts.Targets, err)
+	}
+}
+
+func TestEscapeModulePath(t *testing.T) {
+	zipPath, err := moduleCacheZip("modcache", "github.com/BurntSushi/toml", "v1.0.0-RC1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.ToSlash(zipPath) != "modcache/cache/download/github.com/!burnt!sushi/toml/@v/v1.0.0-!r!c1.zip" {
+		t.Fatalf("unexpected escaped path: %s", zipPath)
+	}
+	if _, err := moduleCacheZip("modcache", "github.com/BurntSushi/toml!", "v1.0.0"); err == nil {
+		t.Fatal("expected an invalid module path to be rejected")
+	}
+}
+
+func TestVendoredModules(t *testing.T) {
+	// modules.txt formats: before go 1.14 without annotations, go 1.14 marking
+	// direct requirements as explicit, go 1.17 marking every requirement
+	for _, fixture := range []string{"vendored-go113", "vendored", "vendored-go117"} {
+		for _, includeIndirect := range []bool{false, true} {
+			testVendoredModules(t, fixture, includeIndirect)
+		}
+	}
+}
+
+func TestParseDirectRequirements(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gomod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	goMod := filepath.Join(tmp, "go.mod")
+	err = ioutil.WriteFile(goMod, []byte(`module example.com/m
+
+go 1.22.1
+
+toolchain go1.22.3
+
+require example.com/red v0.1.0
+
+require (
+	example.com/blue v1.2.0 // indirect
+	example.com/green v1.0.0 // indirect; pinned
+	"example.com/yellow" v1.0.0 // pinned
+)
+
+tool example.com/gen
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := parseDirectRequirements(goMod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(direct)
+	wanted := "map[example.com/blue:false example.com/green:false example.com/red:true example.com/yellow:true]"
+	if got != wanted {
+		t.Fatalf("unexpected direct requirements: %s != %s", got, wanted)
+	}
+}
+
+func testVendoredModules(t *testing.T, fixture string, includeIndirect bool) {
+	licenses, err := listVendorLicenses(filepath.Join("testdata", fixture),
+		loadOptions{IncludeIndirectDeps: includeIndirect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range licenses {
+		s := fmt.Sprintf("%s %s", l.Package, l.Version)
+		if l.ReplacePath != "" {
+			s += fmt.Sprintf(" => %s %s", l.ReplacePath, l.ReplaceVersion)
+		}
+		got = append(got, s+" "+l.Template.Title)
+	}
+	wanted := []string{
+		`example.com/red v0.1.0 => example.com/fork/red v0.1.1 MIT License`,
+		`example.com/red/third_party/stripes v0.1.0 => example.com/fork/red v0.1.1 GNU General Public License v3.0`,
+	}
+	if includeIndirect {
+		wanted = append([]string{`example.com/blue v1.2.0 Apache License 2.0`}, wanted...)
+	}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("%s licenses do not match:\n%s\n!=\n%s",
+			fixture, strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestModFilesSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "licenses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	goMod := filepath.Join(dir, "go.mod")
+	if err := ioutil.WriteFile(goMod, []byte("module example.com/m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := modFilesSnapshot{
+		goMod:                        []byte("module example.com/m\n"),
+		filepath.Join(dir, "go.sum"): nil,
+	}
+	if err := snapshot.verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.sum"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.verify(); err == nil {
+		t.Fatal("no error on created go.sum")
+	}
+}
+
+func TestParentModuleLicense(t *testing.T) {
+	modCache, err := filepath.Abs(filepath.Join("testdata", "modcache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm, err := newLicenseMatcher(loadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm.modCache = modCache
+	for version, wanted := range map[string]string{
+		// same version as the parent module
+		"v1.2.0": "example.com/multi@v1.2.0",
+		// highest version of the parent module
+		"v1.3.0": "example.com/multi@v1.10.0",
+	} {
+		dir, err := moduleCacheDir(modCache, "example.com/multi/nested", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, parent, err := lm.findParentLicense(&PkgInfo{
+			Dir:        dir,
+			Root:       dir,
+			ImportPath: "example.com/multi/nested",
+			Version:    version,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parent != wanted || path != filepath.Join(modCache, wanted, "LICENSE") {
+			t.Fatalf("unexpected parent license for %s: %s from %s", version, path, parent)
+		}
+	}
+}
+
+func TestNestedLicenses(t *testing.T) {
+	for perPackage, wanted := range map[bool][]string{
+		false: {
+			`example.com/red MIT License`,
+			`example.com/red/third_party/stripes GNU General Public License v3.0`,
+		},
+		true: {
+			`example.com/red/paint MIT License`,
+			`example.com/red/third_party/stripes GNU General Public License v3.0`,
+		},
+	} {
+		licenses, err := listVendorLicenses(filepath.Join("testdata", "vendored"),
+			loadOptions{PerPackage: perPackage})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, l := range licenses {
+			got = append(got, l.Package+" "+l.Template.Title)
+		}
+		if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+			t.Fatalf("nested licenses do not match:\n%s\n!=\n%s",
+				strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+		}
+	}
+}
+
+func TestTestOnlyDependencies(t *testing.T) {
+	gopath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	licenses, err := listLicenses([]string{"colors/green"}, loadOptions{
+		Gopath:     gopath,
+		Categories: []string{CategoryRuntime, CategoryTestOnly},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range licenses {
+		got = append(got, l.Package+" "+l.Category)
+	}
+	wanted := []string{"colors/blue test-only", "colors/green runtime"}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("categories do not match:\n%s\n!=\n%s",
+			strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestToolDependencies(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "tools"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tools are required by tools/tools.go, outside of the requested
+	// packages, and by a tool directive of go.mod
+	licenses, err := listLicenses([]string{"example.com/app"}, loadOptions{
+		Dir:         dir,
+		NoWorkspace: true,
+		Env:         []string{"GOFLAGS="},
+		Categories:  []string{CategoryRuntime, CategoryTool},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range licenses {
+		got = append(got, l.Package+" "+l.Category)
+	}
+	wanted := []string{"example.com/gen tool", "example.com/lib runtime", "example.com/linter tool"}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("categories do not match:\n%s\n!=\n%s",
+			strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestParseCategories(t *testing.T) {
+	categories, err := ParseCategories(strings.Split("runtime,tool", ","))
+	if err != nil || strings.Join(categories, ",") != "runtime,tool" {
+		t.Fatalf("unexpected categories %v: %v", categories, err)
+	}
+	for _, spec := range []string{"", "runtime,build"} {
+		if _, err := ParseCategories(strings.Split(spec, ",")); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestModGraphAttribution(t *testing.T) {
+	graph := parseModGraph(`example.com/main example.com/a@v1.0.0
+example.com/main example.com/b@v1.0.0
+example.com/main example.com/c@v1.2.0
+example.com/main example.com/d@v1.0.0
+example.com/main go@1.21
+example.com/a@v1.0.0 example.com/c@v1.1.0
+example.com/b@v1.0.0 example.com/c@v1.2.0
+example.com/c@v1.1.0 example.com/e@v1.0.0
+example.com/c@v1.2.0 example.com/d@v1.0.0
+`, map[string]bool{"example.com/c": true, "example.com/d": true})
+	infos := []*PkgInfo{
+		{ImportPath: "example.com/a"},
+		{ImportPath: "example.com/c"},
+		{ImportPath: "example.com/d"},
+		{ImportPath: "example.com/e"},
+	}
+	graph.annotate(infos)
+	expected := []string{
+		"example.com/a 1 [example.com/a]",
+		"example.com/c 2 [example.com/a example.com/b]",
+		"example.com/d 3 [example.com/a example.com/b]",
+		"example.com/e 0 []",
+	}
+	for i, info := range infos {
+		got := fmt.Sprintf("%s %d %v", info.ImportPath, info.Depth, info.IntroducedBy)
+		if got != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], got)
+		}
+	}
+}
+
+func TestModGraphPrerelease(t *testing.T) {
+	graph := parseModGraph(`example.com/main example.com/a@v1.0.0-rc.9
+example.com/main example.com/b@v1.0.0
+example.com/b@v1.0.0 example.com/a@v1.0.0-rc.10
+example.com/a@v1.0.0-rc.9 example.com/c@v1.0.0
+example.com/a@v1.0.0-rc.10 example.com/d@v1.0.0
+`, nil)
+	if got := graph.requires["example.com/a"]; fmt.Sprint(got) != "[example.com/d]" {
+		t.Errorf("expected the requirements of v1.0.0-rc.10, got %v", got)
+	}
+}
+
+func TestModGraphDiagnostic(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the go command wrapper is a shell script")
+	}
+	tmp, err := ioutil.TempDir("", "modgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	goCommand := filepath.Join(tmp, "go")
+	wrapper := "#!/bin/sh\nif [ \"$1 $2\" = \"mod graph\" ]; then echo 'go: graph unavailable' >&2; exit 1; fi\nexec go \"$@\"\n"
+	if err := ioutil.WriteFile(goCommand, []byte(wrapper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, withGraph := range []bool{false, true} {
+		licenses, graph, err := listLicensesAndGraph([]string{"github.com/solo-io/go-list-licenses/pkg/license"},
+			loadOptions{Dir: filepath.Join("..", ".."), GoCommand: goCommand}, withGraph)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if graph != nil || len(licenses) == 0 {
+			t.Fatalf("expected licenses without a module graph, got %v and %+v", graph, licenses)
+		}
+		for _, l := range licenses {
+			warned := false
+			for _, d := range l.Diagnostics {
+				warned = warned || strings.Contains(d.Message, "unable to load the module graph")
+			}
+			if warned != (withGraph && l.Version != "") {
+				t.Fatalf("unexpected diagnostics of %s with the module graph %v: %v", l.Package, withGraph, l.Diagnostics)
+			}
+		}
+	}
+}
+
+func TestImportChains(t *testing.T) {
+	gopath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := listTargetsDependencies([]string{"colors/cmd/paint", "colors/green"}, loadOptions{
+		Gopath:     gopath,
+		Categories: []string{CategoryRuntime, CategoryTestOnly},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, info := range infos {
+		got = append(got, info.ImportPath+": "+strings.Join(info.ImportChain, " > "))
+	}
+	wanted := []string{
+		"colors/blue: colors/green > colors/blue",
+		"colors/cmd/paint: colors/cmd/paint",
+		"colors/green: colors/green",
+		"colors/red: colors/cmd/paint > colors/red",
+	}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("import chains do not match:\n%s\n!=\n%s",
+			strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestFindModules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "licenses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, d := range []string{"", "projects/a", "projects/b/nested", "vendor/c", "testdata/d", ".git/e", "_old/f"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, d, "go.mod"), []byte("module example.com/m\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirs, err := findModules(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, d := range dirs {
+		rel, err := filepath.Rel(dir, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, filepath.ToSlash(rel))
+	}
+	wanted := []string{".", "projects/a", "projects/b/nested"}
+	if strings.Join(got, " ") != strings.Join(wanted, " ") {
+		t.Fatalf("unexpected modules: %v", got)
+	}
+}
+
+func TestMonorepoSharedDependency(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "monorepo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// example.com/shared is only used by the tests of example.com/a, and by
+	// the binary of example.com/b
+	licenses, err := listMonorepoLicenses(dir, loadOptions{
+		Env:        []string{"GOFLAGS="},
+		Categories: []string{CategoryRuntime, CategoryTestOnly},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range licenses {
+		got = append(got, fmt.Sprintf("%s %s %v", l.Package, l.Category, l.UsedByModules))
+	}
+	wanted := []string{"example.com/shared runtime [example.com/a example.com/b]"}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("monorepo licenses do not match:\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestMergeLicenseCategory(t *testing.T) {
+	for _, test := range [][3]string{
+		{CategoryTestOnly, CategoryRuntime, CategoryRuntime},
+		{CategoryRuntime, CategoryTool, CategoryRuntime},
+		// categories are unknown without packages, such as for go.mod files
+		{"", CategoryTool, CategoryTool},
+		{CategoryTestOnly, "", CategoryTestOnly},
+	} {
+		l := License{Package: "example.com/shared", Category: test[0], UsedByModules: []string{"example.com/a"}}
+		mergeLicense(&l, License{Package: "example.com/shared", Category: test[1], UsedByModules: []string{"example.com/b"}})
+		if l.Category != test[2] || strings.Join(l.UsedByModules, " ") != "example.com/a example.com/b" {
+			t.Errorf("merging %q into %q: got %q used by %v, expected %q", test[1], test[0], l.Category, l.UsedByModules, test[2])
+		}
+	}
+}
+
+func TestWorkspace(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "workspace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// -mod=mod is not allowed in workspaces
+	lo := loadOptions{Dir: dir, Env: []string{"GOFLAGS="}}
+	gowork, err := goWorkFile(lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gowork != filepath.Join(dir, "go.work") {
+		t.Fatalf("unexpected go.work file: %q", gowork)
+	}
+	patterns, err := defaultPatterns(lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(patterns, " ") != "example.com/api/... example.com/web/..." {
+		t.Fatalf("unexpected default patterns: %v", patterns)
+	}
+	licenses, err := listLicenses(patterns, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range licenses {
+		got = append(got, fmt.Sprintf("%s %v %v", l.Package, l.UsedBy, l.UsedByModules))
+	}
+	wanted := []string{
+		"example.com/shared [example.com/api/cmd/api example.com/web/cmd/web] [example.com/api example.com/web]",
+	}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("workspace licenses do not match:\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestLoadOptionsCommand(t *testing.T) {
+	cmd := loadOptions{
+		Dir:       "testdata",
+		GoCommand: "/usr/local/go/bin/go",
+		Env:       []string{"GOFLAGS=-mod=mod -tags=enterprise", "GOPRIVATE=example.com"},
+		Offline:   true,
+	}.command("list")
+	if cmd.Path != "/usr/local/go/bin/go" || cmd.Dir != "testdata" {
+		t.Fatalf("unexpected command %s in %s", cmd.Path, cmd.Dir)
+	}
+	env := map[string]string{}
+	for _, v := range cmd.Env {
+		i := strings.Index(v, "=")
+		if _, ok := env[v[:i]]; ok {
+			t.Fatalf("%s is set twice", v[:i])
+		}
+		env[v[:i]] = v[i+1:]
+	}
+	// offline settings take precedence over the supplied ones, other flags are kept
+	if env["GOFLAGS"] != "-tags=enterprise -mod=readonly" || env["GOPRIVATE"] != "example.com" {
+		t.Fatalf("unexpected environment: GOFLAGS=%s GOPRIVATE=%s", env["GOFLAGS"], env["GOPRIVATE"])
+	}
+	// throwaway modules may be updated
+	cmd = loadOptions{Env: []string{"GOFLAGS=-tags=enterprise -mod=vendor"}, ModMode: "mod"}.command("list")
+	for _, v := range cmd.Env {
+		if strings.HasPrefix(v, "GOFLAGS=") && v != "GOFLAGS=-tags=enterprise -mod=mod" {
+			t.Fatalf("unexpected environment: %s", v)
+		}
+	}
+	if err := validateEnv([]string{"GOFLAGS"}); err == nil {
+		t.Fatal("expected an error for a variable without value")
+	}
+}
+
+func TestBatchPatterns(t *testing.T) {
+	var patterns []string
+	for i := 0; i < 2*maxBatchPatterns+1; i++ {
+		patterns = append(patterns, fmt.Sprintf("example.com/p%d", i))
+	}
+	batches := batchPatterns(patterns)
+	if len(batches) != 3 || len(batches[0]) != maxBatchPatterns || len(batches[2]) != 1 {
+		t.Fatalf("unexpected batches of %d patterns", len(patterns))
+	}
+	long := strings.Repeat("x", maxBatchLength/2)
+	if batches := batchPatterns([]string{long, long, long}); len(batches) != 3 {
+		t.Fatalf("expected one long pattern per batch, got %d batches", len(batches))
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	for msg, wanted := range map[string]string{
+		"package colors/missing: cannot find package":     "*license.MissingError",
+		"go: example.com/m@v1.0.0: missing go.sum entry":  "*license.MissingModuleError",
+		"dial tcp: lookup proxy.golang.org: no such host": "*license.NetworkError",
+		"go: unknown flag -x":                             "<nil>",
+		// network failures cause the modules they were downloading to be missing
+		"go: example.com/m@v1.0.0: reading https://proxy.golang.org/example.com/m/@v/v1.0.0.mod: " +
+			"dial tcp: lookup proxy.golang.org: no such host\ngo: example.com/m@v1.0.0: missing go.sum entry": "*license.NetworkError",
+		"no required module provides package example.com/m/p; " +
+			"to add it: go get example.com/m, invalid version": "*license.MissingError",
+	} {
+		if got := fmt.Sprintf("%T", classifyError(msg)); got != wanted {
+			t.Errorf("%q classified as %s, expected %s", msg, got, wanted)
+		}
+	}
+}
+
+func TestPackageError(t *testing.T) {
+	for _, test := range []struct {
+		pkg    goListPackage
+		wanted string
+	}{
+		{goListPackage{Dir: "/m/p", GoFiles: []string{"p.go"}}, "<nil>"},
+		{goListPackage{Dir: "/m/p", GoFiles: []string{"p.go"},
+			DepsErrors: []*PkgError{{Err: "cannot find package example.com/q"}}}, "<nil>"},
+		{goListPackage{Dir: "/m/p", GoFiles: []string{"p.go"},
+			DepsErrors: []*PkgError{{Err: "example.com/q@v1.0.0: dial tcp: i/o timeout"}}}, "*license.NetworkError"},
+		{goListPackage{Module: &goListModule{Error: &PkgError{Err: "example.com/m@v1.0.0: 404 Not Found"}},
+			Error: &PkgError{Err: "cannot find package"}}, "*license.MissingModuleError"},
+		{goListPackage{Error: &PkgError{Err: "no required module provides package example.com/m/p"}},
+			"*license.MissingError"},
+		{goListPackage{Error: &PkgError{Err: "cannot find module providing package example.com/m/p: " +
+			"module lookup disabled by GOPROXY=off"}}, "*license.MissingModuleError"},
+		{goListPackage{Dir: "/m/p", Error: &PkgError{Err: "build constraints exclude all Go files in /m/p"}},
+			"*license.MissingError"},
+		// the messages of build errors may quote anything
+		{goListPackage{Dir: "/m/p", GoFiles: []string{"p.go"},
+			Error: &PkgError{Err: `p.go:1:1: expected 'package', found "cannot find package"`}}, "*license.BuildError"},
+	} {
+		if got := fmt.Sprintf("%T", packageError(&test.pkg)); got != test.wanted {
+			t.Errorf("%+v classified as %s, expected %s", test.pkg, got, test.wanted)
+		}
+	}
+}
+
+func TestUnreadableModuleDiagnostic(t *testing.T) {
+	gopath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missingDir := filepath.Join(gopath, "src", "colors", "deleted")
+	licenses, err := matchLicenses([]*PkgInfo{
+		{ImportPath: "colors/deleted", Dir: missingDir, Root: gopath},
+		{ImportPath: "colors/red", Dir: filepath.Join(gopath, "src", "colors", "red"), Root: gopath},
+	}, loadOptions{Gopath: gopath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(licenses) != 2 {
+		t.Fatalf("expected both packages to be reported, got %d", len(licenses))
+	}
+	if len(licenses[0].Diagnostics) != 1 || licenses[0].Diagnostics[0].Severity != SeverityError {
+		t.Fatalf("expected an error diagnostic, got %v", licenses[0].Diagnostics)
+	}
+	if licenses[1].Template == nil || len(licenses[1].Diagnostics) != 0 {
+		t.Fatalf("unexpected colors/red license: %+v", licenses[1])
+	}
+	if err := failingDiagnostics(licenses, &genericProduct{}, SeverityNone); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if err := failingDiagnostics(licenses, &genericProduct{}, SeverityWarning); err == nil {
+		t.Fatal("expected the error diagnostic to fail the run")
+	}
+	// unreadable licenses have no license to filter out when checking licenses
+	checked := NewGlooProductLicenseHandler(nil, map[string]interface{}{"Apache License 2.0": true})
+	if err := failingDiagnostics(licenses, checked, SeverityError); err == nil {
+		t.Fatal("expected the unreadable license to fail the check")
+	}
+	skipped := NewGlooProductLicenseHandler([]string{"colors/deleted"}, map[string]interface{}{"MIT License": true})
+	if err := failingDiagnostics(licenses, skipped, SeverityError); err != nil {
+		t.Fatalf("unexpected failure of a skipped dependency: %s", err)
+	}
+}
+
+func TestModFileLicenses(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gomod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	license, err := ioutil.ReadFile(filepath.Join("testdata", "src", "colors", "red", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"m/go.mod": "module example.com/m\n\ngo 1.16\n\nrequire example.com/red v1.0.0\n\n" +
+			"replace example.com/red => ../red\n",
+		"red/go.mod":  "module example.com/red\n\ngo 1.16\n",
+		"red/LICENSE": string(license),
+	}
+	for name, content := range files {
+		path := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	licenses, err := listModFileLicenses(filepath.Join(tmp, "m", "go.mod"), "", loadOptions{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(licenses) != 1 || licenses[0].Package != "example.com/red" || licenses[0].Template == nil {
+		t.Fatalf("unexpected licenses: %+v", licenses)
+	}
+}
+
+func TestOfflineEmptyModCache(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	goMod := "module example.com/m\n\ngo 1.16\n\nrequire (\n\texample.com/blue v1.0.0\n\texample.com/red v1.2.0\n)\n"
+	goSum := "example.com/blue v1.0.0/go.mod h1:Nl5z0/4Jkq3nU7wU9h0yK1lXqWq+0bXN0C0Lw9pVh5A=\n"
+	if err := ioutil.WriteFile(filepath.Join(tmp, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "go.sum"), []byte(goSum), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modCache := filepath.Join(tmp, "modcache")
+	lo := loadOptions{Offline: true, Env: []string{"GOMODCACHE=" + modCache, "GOFLAGS="}}
+	licenses, err := listModFileLicenses(filepath.Join(tmp, "go.mod"), "", lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range licenses {
+		got = append(got, fmt.Sprintf("%s %s %t", l.Package, l.Version, strings.HasPrefix(l.Err, "not available: ")))
+	}
+	wanted := []string{"example.com/blue v1.0.0 true", "example.com/red v1.2.0 true"}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("offline licenses do not match:\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+	// nothing was downloaded nor written to go.mod and go.sum
+	if entries, _ := ioutil.ReadDir(modCache); len(entries) != 0 {
+		t.Fatalf("the module cache was populated with %s", entries[0].Name())
+	}
+	for name, content := range map[string]string{"go.mod": goMod, "go.sum": goSum} {
+		data, err := ioutil.ReadFile(filepath.Join(tmp, name))
+		if err != nil || string(data) != content {
+			t.Fatalf("%s was modified: %v", name, err)
+		}
+	}
+}
+
+// writeProxyModule adds the version of a module with files to the file:// proxy
+// in dir.
+func writeProxyModule(t *testing.T, dir, path, version string, files map[string]string) {
+	modDir := filepath.Join(dir, filepath.FromSlash(path), "@v")
+	if err := os.MkdirAll(modDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := ioutil.ReadFile(filepath.Join(modDir, "list"))
+	contents := map[string]string{
+		"list":            string(list) + version + "\n",
+		version + ".info": fmt.Sprintf(`{"Version":%q}`, version),
+		version + ".mod":  files["go.mod"],
+	}
+	for name, content := range contents {
+		if err := ioutil.WriteFile(filepath.Join(modDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(path + "@" + version + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(modDir, version+".zip"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCandidateLicenses(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "evaluate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modCache := filepath.Join(tmp, "modcache")
+	defer func() {
+		// the module cache is read-only
+		clean := exec.Command("go", "clean", "-modcache")
+		clean.Env = append(os.Environ(), "GOMODCACHE="+modCache, "GOFLAGS=")
+		clean.Run()
+		os.RemoveAll(tmp)
+	}()
+	license, err := ioutil.ReadFile(filepath.Join("testdata", "src", "colors", "red", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := filepath.Join(tmp, "proxy")
+	writeProxyModule(t, proxy, "example.com/dep", "v1.0.0", map[string]string{
+		"go.mod":  "module example.com/dep\n\ngo 1.16\n",
+		"LICENSE": string(license),
+	})
+	writeProxyModule(t, proxy, "example.com/candidate", "v1.4.0", map[string]string{
+		"go.mod":  "module example.com/candidate\n\ngo 1.16\n\nrequire example.com/dep v1.0.0\n",
+		"LICENSE": string(license),
+	})
+	writeProxyModule(t, proxy, "example.com/required", "v1.0.0", map[string]string{
+		"go.mod":  "module example.com/required\n\ngo 1.16\n",
+		"LICENSE": string(license),
+	})
+	goMod := filepath.Join(tmp, "m", "go.mod")
+	original := "module example.com/m\n\ngo 1.16\n\nrequire example.com/required v1.0.0\n"
+	if err := os.MkdirAll(filepath.Dir(goMod), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(goMod, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	licenses, err := listCandidateLicenses("example.com/candidate@v1.4.0", loadOptions{
+		Dir: filepath.Dir(goMod),
+		// without go.sum, -mod=mod would add it to the module
+		Env: []string{"GOPROXY=file://" + filepath.ToSlash(proxy), "GOSUMDB=off", "GOMODCACHE=" + modCache,
+			"GOFLAGS=-mod=mod"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range licenses {
+		got = append(got, fmt.Sprintf("%s %s %d %v", l.Package, l.Version, l.Depth, l.Template != nil))
+	}
+	wanted := []string{
+		"example.com/candidate v1.4.0 1 true",
+		"example.com/dep v1.0.0 2 true",
+	}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("licenses do not match:\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+	data, err := ioutil.ReadFile(goMod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Fatalf("go.mod was modified:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "m", "go.sum")); !os.IsNotExist(err) {
+		t.Fatalf("go.sum was created: %v", err)
+	}
+}
+
+func TestBinaryDependencies(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "binaries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modCache := filepath.Join(tmp, "modcache")
+	defer func() {
+		clean := exec.Command("go", "clean", "-modcache")
+		clean.Env = append(os.Environ(), "GOMODCACHE="+modCache, "GOFLAGS=")
+		clean.Run()
+		os.RemoveAll(tmp)
+	}()
+	license, err := ioutil.ReadFile(filepath.Join("testdata", "src", "colors", "red", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := filepath.Join(tmp, "proxy")
+	writeProxyModule(t, proxy, "example.com/dep", "v1.0.0", map[string]string{
+		"go.mod":  "module example.com/dep\n\ngo 1.16\n",
+		"LICENSE": string(license),
+		"dep.go":  "package dep\n\nfunc Dep() {}\n",
+	})
+	dir := filepath.Join(tmp, "m")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"go.mod":  "module example.com/m\n\ngo 1.16\n",
+		"main.go": "package main\n\nimport \"example.com/dep\"\n\nfunc main() { dep.Dep() }\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lo := loadOptions{
+		Dir: dir,
+		Env: []string{"GOPROXY=file://" + filepath.ToSlash(proxy), "GOSUMDB=off", "GOMODCACHE=" + modCache,
+			"GOFLAGS=-mod=mod"},
+	}
+	binary := filepath.Join(tmp, "m.bin")
+	if _, err := lo.run(Target{}, "build", "-o", binary, "."); err != nil {
+		t.Fatal(err)
+	}
+	infos, goVersions, err := listBinaryDependencies([]string{binary}, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := lo.goEnv("GOVERSION")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goVersions) != 1 || strings.Join(goVersions[values[0]], ",") != binary {
+		t.Fatalf("expected the binary to be built with %s, got %v", values[0], goVersions)
+	}
+	if len(infos) != 1 || infos[0].ImportPath != "example.com/dep" || infos[0].Version != "v1.0.0" ||
+		infos[0].Error != nil || infos[0].Sum == "" || strings.Join(infos[0].UsedBy, ",") != binary {
+		t.Fatalf("expected example.com/dep to be linked into the binary, got %+v", infos)
+	}
+	licenses, err := matchLicenses(infos, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(licenses) != 1 || licenses[0].Template == nil || licenses[0].Template.Title != "MIT License" {
+		t.Fatalf("expected the license of example.com/dep, got %+v", licenses)
+	}
+}
+
+func TestProxyFallback(t *testing.T) {
+	proxy, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(proxy)
+	license, err := ioutil.ReadFile(filepath.Join("testdata", "src", "colors", "red", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeProxyModule(t, proxy, "example.com/Missing", "v1.0.0", map[string]string{
+		"go.mod":          "module example.com/Missing\n\ngo 1.16\n",
+		"LICENSE":         string(license),
+		"sub/LICENSE.txt": "not the module license",
+	})
+	server := httptest.NewServer(http.FileServer(http.Dir(proxy)))
+	defer server.Close()
+	// the proxy escapes upper case letters, unlike the file paths of the zip
+	if err := os.Rename(filepath.Join(proxy, "example.com", "Missing"), filepath.Join(proxy, "example.com", "!missing")); err != nil {
+		t.Fatal(err)
+	}
+
+	infos := []*PkgInfo{
+		newModuleInfo(&goListModule{Path: "example.com/Missing", Version: "v1.0.0"}),
+		newModuleInfo(&goListModule{Path: "example.com/unknown", Version: "v1.0.0"}),
+	}
+	licenses, err := matchLicenses(infos, loadOptions{
+		Offline:       true,
+		ProxyFallback: true,
+		Env:           []string{"GOPROXY=" + server.URL, "GONOPROXY=", "GOPRIVATE="},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(licenses) != 2 {
+		t.Fatalf("expected 2 licenses, got %+v", licenses)
+	}
+	if licenses[0].Template == nil || licenses[0].Err != "" || !strings.HasSuffix(licenses[0].Path, "v1.0.0.zip#LICENSE") {
+		t.Fatalf("expected the license to be downloaded, got %+v", licenses[0])
+	}
+	if licenses[1].Err == "" || len(licenses[1].Diagnostics) != 1 || licenses[1].Diagnostics[0].Severity != SeverityError {
+		t.Fatalf("expected an error for the unknown module, got %+v", licenses[1])
+	}
+}
+
+func TestProxyFetcherLimits(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/example.com/stalled/") {
+			<-release
+		}
+		w.Write(bytes.Repeat([]byte("0"), 1024))
+	}))
+	defer server.Close()
+	defer close(release)
+	f := newProxyFetcher(loadOptions{Env: []string{"GOPROXY=" + server.URL, "GONOPROXY=", "GOPRIVATE="}})
+	f.client.Timeout = 100 * time.Millisecond
+	if _, _, err := f.fetchZip("example.com/stalled", "v1.0.0"); err == nil {
+		t.Fatal("expected the stalled proxy to time out")
+	}
+	f.maxSize = 512
+	if _, _, err := f.fetchZip("example.com/large", "v1.0.0"); err == nil || !strings.Contains(err.Error(), "larger than 512 bytes") {
+		t.Fatalf("expected the zip to be too large, got %v", err)
+	}
+	f.maxSize = 1024
+	if data, _, err := f.fetchZip("example.com/large", "v1.0.0"); err != nil || len(data) != 1024 {
+		t.Fatalf("expected the zip to be read, got %d bytes: %v", len(data), err)
+	}
+}
+
+func TestMatchPathPrefix(t *testing.T) {
+	patterns := []string{"*.corp.example.com", "example.com/private"}
+	for modPath, expected := range map[string]bool{
+		"git.corp.example.com/team/repo": true,
+		"example.com/private":            true,
+		"example.com/private/sub":        true,
+		"example.com/privateer":          false,
+		"example.com":                    false,
+	} {
+		if got := matchPathPrefix(patterns, modPath); got != expected {
+			t.Errorf("%s: expected %v, got %v", modPath, expected, got)
+		}
+	}
+}
+
+func TestModuleCacheZipLicense(t *testing.T) {
+	modCache, err := ioutil.TempDir("", "modcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(modCache)
+	license, err := ioutil.ReadFile(filepath.Join("testdata", "src", "colors", "red", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the download cache has the layout of a proxy, the extracted directory is pruned
+	writeProxyModule(t, filepath.Join(modCache, "cache", "download"), "example.com/pruned", "v1.0.0", map[string]string{
+		"go.mod":  "module example.com/pruned\n\ngo 1.16\n",
+		"COPYING": string(license),
+	})
+	licenses, err := matchLicenses([]*PkgInfo{
+		newModuleInfo(&goListModule{Path: "example.com/pruned", Version: "v1.0.0"}),
+	}, loadOptions{Offline: true, Env: []string{"GOMODCACHE=" + modCache}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(licenses) != 1 || licenses[0].Template == nil || licenses[0].Err != "" ||
+		!strings.HasSuffix(licenses[0].Path, "v1.0.0.zip#COPYING") {
+		t.Fatalf("expected the license to be read from the zip, got %+v", licenses)
+	}
+}
+
+func TestUpstreamLicense(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	fork, err := filepath.Abs(filepath.Join("testdata", "src", "colors", "red"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apache, err := ioutil.ReadFile(filepath.Join("testdata", "src", "colors", "blue", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// upstream modules are not extracted, one is in the download cache, the
+	// other in the module proxy
+	modCache := filepath.Join(tmp, "modcache")
+	writeProxyModule(t, filepath.Join(modCache, "cache", "download"), "example.com/cached", "v1.0.0", map[string]string{
+		"go.mod":  "module example.com/cached\n\ngo 1.16\n",
+		"LICENSE": string(apache),
+	})
+	proxy := filepath.Join(tmp, "proxy")
+	writeProxyModule(t, proxy, "example.com/proxied", "v1.0.0", map[string]string{
+		"go.mod":  "module example.com/proxied\n\ngo 1.16\n",
+		"LICENSE": string(apache),
+	})
+	server := httptest.NewServer(http.FileServer(http.Dir(proxy)))
+	defer server.Close()
+
+	var infos []*PkgInfo
+	for _, modPath := range []string{"example.com/cached", "example.com/proxied", "example.com/unknown"} {
+		infos = append(infos, newModuleInfo(&goListModule{
+			Path:    modPath,
+			Version: "v1.0.0",
+			Dir:     fork,
+			Replace: &goListModule{Path: fork},
+		}))
+	}
+	licenses, err := matchLicenses(infos, loadOptions{
+		Offline:       true,
+		ProxyFallback: true,
+		Env:           []string{"GOMODCACHE=" + modCache, "GOPROXY=" + server.URL, "GONOPROXY=", "GOPRIVATE="},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range licenses {
+		for _, d := range l.Diagnostics {
+			got = append(got, l.Package+": "+strings.Replace(d.Message, fork, "fork", -1))
+		}
+	}
+	wanted := []string{
+		"example.com/cached: example.com/cached is replaced by fork whose license (MIT License) differs from upstream example.com/cached@v1.0.0 (Apache License 2.0)",
+		"example.com/proxied: example.com/proxied is replaced by fork whose license (MIT License) differs from upstream example.com/proxied@v1.0.0 (Apache License 2.0)",
+		"example.com/unknown: unable to compare with the upstream module: unable to download example.com/unknown@v1.0.0: " +
+			server.URL + "/example.com/unknown/@v/v1.0.0.zip: 404 Not Found",
+	}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("upstream diagnostics do not match:\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestVerifyModules(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modCache := filepath.Join(tmp, "modcache")
+	defer func() {
+		clean := exec.Command("go", "clean", "-modcache")
+		clean.Env = append(os.Environ(), "GOMODCACHE="+modCache, "GOFLAGS=")
+		clean.Run()
+		os.RemoveAll(tmp)
+	}()
+	license, err := ioutil.ReadFile(filepath.Join("testdata", "src", "colors", "red", "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := filepath.Join(tmp, "proxy")
+	writeProxyModule(t, proxy, "example.com/dep", "v1.0.0", map[string]string{
+		"go.mod":  "module example.com/dep\n\ngo 1.16\n",
+		"LICENSE": string(license),
+		"dep.go":  "package dep\n",
+	})
+	dir := filepath.Join(tmp, "m")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lo := loadOptions{
+		Dir:    dir,
+		Verify: true,
+		Env: []string{"GOPROXY=file://" + filepath.ToSlash(proxy), "GOSUMDB=off", "GOMODCACHE=" + modCache,
+			"GOFLAGS=-mod=mod"},
+	}
+	if _, err := lo.run(Target{}, "get", "example.com/dep@v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	modules, err := lo.listModules("example.com/dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func() []Diagnostic {
+		licenses, err := matchLicenses([]*PkgInfo{newModuleInfo(modules[0])}, lo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(licenses) != 1 || licenses[0].Template == nil {
+			t.Fatalf("expected the license of example.com/dep, got %+v", licenses)
+		}
+		return licenses[0].Diagnostics
+	}
+	if diagnostics := verify(); len(diagnostics) != 0 {
+		t.Fatalf("expected the module to match go.sum, got %v", diagnostics)
+	}
+
+	// the module cache is read-only
+	if err := os.Chmod(modules[0].Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(modules[0].Dir, "LICENSE")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(modules[0].Dir, "LICENSE"), append(license, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics := verify(); len(diagnostics) != 1 || diagnostics[0].Severity != SeverityError {
+		t.Fatalf("expected the modified license to be reported, got %v", diagnostics)
+	}
+
+	// the zip of a pruned module is verified instead
+	if err := os.RemoveAll(modules[0].Dir); err != nil {
+		t.Fatal(err)
+	}
+	modules[0].Dir = ""
+	if diagnostics := verify(); len(diagnostics) != 0 {
+		t.Fatalf("expected the module zip to match go.sum, got %v", diagnostics)
+	}
+}
+
+func TestVerifyModuleSources(t *testing.T) {
+	modCache, err := filepath.Abs(filepath.Join("testdata", "modcache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := dirhash.HashDir(filepath.Join(modCache, "example.com", "multi@v1.2.0"), "example.com/multi@v1.2.0",
+		dirhash.Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		module string
+		goSum  string
+		sum    string
+		wanted string
+	}{
+		// the inherited license is verified with the parent module
+		{module: "example.com/multi/nested", goSum: sum, wanted: ""},
+		{module: "example.com/multi/nested", goSum: "h1:modified",
+			wanted: "example.com/multi@v1.2.0 does not match go.sum"},
+		// binaries only record the hashes of the modules they link
+		{module: "example.com/multi/nested", sum: "h1:nested",
+			wanted: "no hash in the build info to verify example.com/multi@v1.2.0 against"},
+		{module: "example.com/multi", goSum: "h1:modified", sum: sum, wanted: ""},
+		{module: "example.com/multi", goSum: sum, sum: "h1:modified",
+			wanted: "example.com/multi@v1.2.0 does not match the build info"},
+	} {
+		lm, err := newLicenseMatcher(loadOptions{Verify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lm.modCache = modCache
+		lm.goSums = map[string]string{"example.com/multi v1.2.0": test.goSum}
+		dir := filepath.Join(modCache, filepath.FromSlash(test.module)+"@v1.2.0")
+		license := License{}
+		if err := lm.matchLicense(&PkgInfo{
+			Dir:        dir,
+			Root:       dir,
+			ImportPath: test.module,
+			Version:    "v1.2.0",
+			Sum:        test.sum,
+		}, &license); err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		for _, d := range license.Diagnostics {
+			if d.Severity >= SeverityWarning {
+				got = d.Message
+			}
+		}
+		if !strings.HasPrefix(got, test.wanted) || (test.wanted == "") != (got == "") {
+			t.Errorf("%s (go.sum %s, build info %s): expected %q, got %q", test.module, test.goSum, test.sum, test.wanted, got)
+		}
+	}
+}
+
+func TestNativeCode(t *testing.T) {
+	gopath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cgo is disabled by default for cross targets
+	target := Target{GOOS: "linux", GOARCH: "arm64"}
+	if runtime.GOARCH == "arm64" {
+		target.GOARCH = "amd64"
+	}
+	infos, err := listModDependencies([]string{"colors/orange"}, target, false, loadOptions{Gopath: gopath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the dependencies are the ones of the !cgo variant, the native code the one of the cgo one
+	if len(infos) != 2 || infos[0].Native == nil || infos[1].ImportPath != "colors/red" {
+		t.Fatalf("expected colors/orange to use native code and import colors/red, got %+v", infos)
+	}
+	cgoInfos, err := listModDependencies([]string{"colors/orange"}, target, false,
+		loadOptions{Gopath: gopath, Env: []string{"CGO_ENABLED=1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cgoInfos) != 1 || cgoInfos[0].Native == nil {
+		t.Fatalf("expected colors/orange to use native code with cgo enabled, got %+v", cgoInfos)
+	}
+	infos = infos[:1]
+	native := infos[0].Native
+	got := strings.Join(native.Libraries, ", ") + "\n" + strings.Join(native.Sources, ", ") + "\n" +
+		strings.Join(native.Notices, "\n")
+	wanted := `m, pigment, pkg-config:cairo
+colors/orange/mix.c, colors/orange/mix.h
+colors/orange/mix.c: The author disclaims copyright to this source code.
+colors/orange/mix.h: SPDX-License-Identifier: MIT`
+	if got != wanted {
+		t.Fatalf("native code does not match:\n%s\n!=\n%s", got, wanted)
+	}
+	licenses, err := matchLicenses(infos, loadOptions{Gopath: gopath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(licenses) != 1 || len(licenses[0].Diagnostics) != 1 || licenses[0].Diagnostics[0].Severity != SeverityWarning {
+		t.Fatalf("expected a native code warning, got %+v", licenses)
+	}
+}
+
+func TestEmbeddedFiles(t *testing.T) {
+	gopath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lo := loadOptions{Gopath: gopath}
+	infos, err := listModDependencies([]string{"colors/white"}, Target{}, false, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	licenses, err := matchLicenses(infos, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range licenses {
+		title := ""
+		if l.Template != nil {
+			title = l.Template.Title
+		}
+		got = append(got, fmt.Sprintf("%s %s %v", l.Package, title, l.Embedded))
+	}
+	wanted := []string{
+		"colors/white MIT License [static/index.html]",
+		"colors/white/fonts SIL Open Font License 1.1 [fonts/OFL.txt fonts/chalk.ttf]",
+	}
+	if strings.Join(got, "\n") != strings.Join(wanted, "\n") {
+		t.Fatalf("embedded licenses do not match:\n%s\n!=\n%s", strings.Join(got, "\n"), strings.Join(wanted, "\n"))
+	}
+}
+
+func TestStdLicense(t *testing.T) {
+	std, err := stdLicense(loadOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if std.Package != StdPackage || !strings.HasPrefix(std.Version, "go") || std.Template == nil ||
+		!strings.Contains(std.Template.Title, "BSD 3-clause") {
+		t.Fatalf("unexpected standard library entry: %s %s %v", std.Package, std.Version, std.Template)
+	}
+	patents, err := ioutil.ReadFile(filepath.Join(filepath.Dir(std.Path), "PATENTS"))
+	if err == nil && !strings.HasSuffix(string(std.FileContent), string(patents)) {
+		t.Fatal("expected the license text to include PATENTS")
+	}
+	// binaries may be built with another Go version
+	std, err = stdLicense(loadOptions{}, "go1.21.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if std.Version != "go1.21.5" || std.ManualPath != "https://go.googlesource.com/go/+/refs/tags/go1.21.5/LICENSE" {
+		t.Fatalf("unexpected standard library entry: %s %s", std.Version, std.ManualPath)
+	}
+}
+
+func TestStdLicensePerGoVersion(t *testing.T) {
+	var licenses []License
+	for _, version := range []string{"go1.21.0", "go1.22.0"} {
+		std, err := stdLicense(loadOptions{}, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		licenses = append(licenses, std)
+	}
+	// binaries built with different Go versions share $GOROOT/LICENSE
+	included, err := printReport(&Options{Product: &genericProduct{}}, "", licenses, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range included {
+		got = append(got, l.Package+" "+l.Version)
+	}
+	if strings.Join(got, ",") != "std go1.21.0,std go1.22.0" {
+		t.Fatalf("unexpected standard library entries: %v", got)
+	}
+}
@@ -0,0 +1,259 @@
+package license
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The loader runs every go command of the analysis and decodes its JSON
+// output. Failures are reported with the typed errors below.
+
+// MissingError is returned when a requested package does not exist or has no
+// buildable Go source files.
+type MissingError struct {
+	Err string
+}
+
+func (err *MissingError) Error() string {
+	return err.Err
+}
+
+// MissingModuleError is returned when a module cannot be resolved, such as an
+// unknown version, a missing go.sum entry or a module missing from the module
+// cache offline.
+type MissingModuleError struct {
+	Err string
+}
+
+func (err *MissingModuleError) Error() string {
+	return err.Err
+}
+
+// BuildError is returned when a requested package cannot be loaded, such as
+// on syntax errors or import cycles.
+type BuildError struct {
+	ImportPath string
+	Err        string
+}
+
+func (err *BuildError) Error() string {
+	return fmt.Sprintf("%s: %s", err.ImportPath, err.Err)
+}
+
+// NetworkError is returned when the go command fails to download modules.
+type NetworkError struct {
+	Err string
+}
+
+func (err *NetworkError) Error() string {
+	return err.Err
+}
+
+// GoCommandError is returned for other failures of the go command.
+type GoCommandError struct {
+	Args   []string
+	Output string
+}
+
+func (err *GoCommandError) Error() string {
+	return fmt.Sprintf("'go %s' failed with:\n%s", strings.Join(err.Args, " "), err.Output)
+}
+
+var (
+	missingPackageMessages = []string{
+		"cannot find package",
+		"no buildable Go source files",
+		"no Go files in",
+		"no required module provides package",
+		"is not in std",
+		"is not in GOROOT",
+	}
+	networkMessages = []string{
+		"dial tcp",
+		"i/o timeout",
+		"connection refused",
+		"connection reset",
+		"no such host",
+		"TLS handshake timeout",
+		"network is unreachable",
+	}
+	missingModuleMessages = []string{
+		"unknown revision",
+		"missing go.sum entry",
+		"module lookup disabled",
+		"cannot find module providing package",
+		"invalid version",
+		"404 Not Found",
+		"410 Gone",
+	}
+)
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyError returns the typed error matching a failure message of the go
+// command, nil if none does. Network failures come first, as they also cause
+// the packages and modules they were downloading to be missing. Failures of
+// listed packages are decided from their fields instead, see packageError.
+func classifyError(msg string) error {
+	switch {
+	case containsAny(msg, networkMessages):
+		return &NetworkError{Err: msg}
+	case containsAny(msg, missingPackageMessages):
+		return &MissingError{Err: msg}
+	case containsAny(msg, missingModuleMessages):
+		return &MissingModuleError{Err: msg}
+	}
+	return nil
+}
+
+// packageError returns the typed error of a requested package which failed to
+// load, nil if it loaded. An error of its module is a module resolution
+// failure, an error of a package without a directory or Go files is a missing
+// package, and other errors are build errors. Network failures, including the
+// ones of its dependencies which make the analysis incomplete, are only told
+// apart by their messages.
+func packageError(pkg *goListPackage) error {
+	switch {
+	case pkg.Module != nil && pkg.Module.Error != nil:
+		if containsAny(pkg.Module.Error.Err, networkMessages) {
+			return &NetworkError{Err: pkg.Module.Error.Err}
+		}
+		return &MissingModuleError{Err: pkg.Module.Error.Err}
+	case pkg.Error == nil:
+		for _, depErr := range pkg.DepsErrors {
+			if containsAny(depErr.Err, networkMessages) {
+				return &NetworkError{Err: depErr.Err}
+			}
+		}
+		return nil
+	case pkg.Dir == "":
+		// the package may be missing as its module could not be resolved
+		if err := classifyError(pkg.Error.Err); err != nil {
+			return err
+		}
+		return &MissingError{Err: pkg.Error.Err}
+	case len(pkg.GoFiles) == 0 && len(pkg.CgoFiles) == 0:
+		return &MissingError{Err: pkg.Error.Err}
+	}
+	return &BuildError{ImportPath: pkg.ImportPath, Err: pkg.Error.Err}
+}
+
+// maxBatchPatterns and maxBatchLength bound the package patterns passed to a
+// single go command, below the argument list limits of every platform.
+const (
+	maxBatchPatterns = 500
+	maxBatchLength   = 16 << 10
+)
+
+// batchPatterns splits patterns into batches fitting on a command line.
+func batchPatterns(patterns []string) [][]string {
+	var batches [][]string
+	var batch []string
+	length := 0
+	for _, p := range patterns {
+		if len(batch) > 0 && (len(batch) == maxBatchPatterns || length+len(p)+1 > maxBatchLength) {
+			batches = append(batches, batch)
+			batch, length = nil, 0
+		}
+		batch = append(batch, p)
+		length += len(p) + 1
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// run runs the go command for target and returns its standard output.
+func (o loadOptions) run(target Target, args ...string) ([]byte, error) {
+	cmd := o.command(args...)
+	cmd.Env = target.env(cmd.Env)
+	out, err := cmd.Output()
+	if err != nil {
+		output := err.Error()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			output = string(exitErr.Stderr)
+		}
+		if typed := classifyError(output); typed != nil {
+			return nil, typed
+		}
+		return nil, &GoCommandError{Args: args, Output: output}
+	}
+	return out, nil
+}
+
+// listPackages runs `go list -e -json` with flags on patterns for target,
+// batching large pattern lists. Packages listed by several batches are
+// returned once, as requested packages if any batch requested them.
+func (o loadOptions) listPackages(target Target, flags []string, patterns []string) ([]*goListPackage, error) {
+	var pkgs []*goListPackage
+	byImportPath := map[string]*goListPackage{}
+	for _, batch := range batchPatterns(patterns) {
+		args := append([]string{"list", "-e", "-json"}, flags...)
+		args = append(args, batch...)
+		out, err := o.run(target, args...)
+		if err != nil {
+			return nil, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(out))
+		for decoder.More() {
+			pkg := &goListPackage{}
+			if err := decoder.Decode(pkg); err != nil {
+				return nil, errors.Wrap(err, "unable to decode go list output")
+			}
+			if seen := byImportPath[pkg.ImportPath]; seen != nil {
+				seen.DepOnly = seen.DepOnly && pkg.DepOnly
+				continue
+			}
+			byImportPath[pkg.ImportPath] = pkg
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs, nil
+}
+
+// listModules runs `go list -m -json` with args.
+func (o loadOptions) listModules(args ...string) ([]*goListModule, error) {
+	out, err := o.run(Target{}, append([]string{"list", "-m", "-json"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	var modules []*goListModule
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	for decoder.More() {
+		mod := &goListModule{}
+		if err := decoder.Decode(mod); err != nil {
+			return nil, errors.Wrap(err, "unable to decode go list output")
+		}
+		modules = append(modules, mod)
+	}
+	return modules, nil
+}
+
+// goEnv returns the values of the go environment variables.
+func (o loadOptions) goEnv(names ...string) ([]string, error) {
+	out, err := o.run(Target{}, append([]string{"env"}, names...)...)
+	if err != nil {
+		return nil, err
+	}
+	values := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(values) != len(names) {
+		return nil, fmt.Errorf("unexpected 'go env' output:\n%s", out)
+	}
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values, nil
+}
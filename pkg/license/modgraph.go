@@ -0,0 +1,240 @@
+package license
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// modGraph is the module requirement graph reported by 'go mod graph',
+// restricted to the versions selected by minimal version selection.
+type modGraph struct {
+	// mains are the main modules, several of them in a go.work workspace
+	mains []string
+	// requires lists the modules required by each selected module, by path.
+	// Requirements of the main modules marked as indirect are only listed if
+	// they are not required by any other module, such as dependencies of
+	// modules without a go.mod file.
+	requires map[string][]string
+	// introducedBy lists the direct dependencies of the main modules that
+	// pull in each module, by path
+	introducedBy map[string][]string
+	// depth is the minimum number of requirements from a main module to each
+	// module, 1 for direct dependencies
+	depth map[string]int
+}
+
+// loadModGraph runs 'go mod graph' for the main module or the go.work
+// workspace, and 'go list -m' to tell direct requirements from indirect ones,
+// since go.mod files list every dependency since go 1.17.
+func loadModGraph(lo loadOptions) (*modGraph, error) {
+	graph, err := lo.run(Target{}, "mod", "graph")
+	if err != nil {
+		return nil, err
+	}
+	modules, err := lo.listModules("all")
+	if err != nil {
+		return nil, err
+	}
+	indirect := map[string]bool{}
+	for _, mod := range modules {
+		if mod.Indirect {
+			indirect[mod.Path] = true
+		}
+	}
+	return parseModGraph(string(graph), indirect), nil
+}
+
+// parseModGraph parses the "module@version requirement@version" lines of 'go
+// mod graph', main modules having no version. Only the requirements of the
+// selected version of each module, the highest one in the graph, are kept.
+// indirect holds the requirements of the main modules marked as indirect.
+func parseModGraph(out string, indirect map[string]bool) *modGraph {
+	type edge struct{ from, to string }
+	var edges []edge
+	selected := map[string]string{}
+	isMain := map[string]bool{}
+	g := &modGraph{
+		requires:     map[string][]string{},
+		introducedBy: map[string][]string{},
+		depth:        map[string]int{},
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		// go and toolchain requirements are not modules
+		if to, _ := splitModVersion(fields[1]); to == "go" || to == "toolchain" {
+			continue
+		}
+		for _, node := range fields {
+			path, version := splitModVersion(node)
+			if version == "" {
+				if !isMain[path] {
+					isMain[path] = true
+					g.mains = append(g.mains, path)
+				}
+			} else if semver.Compare(version, selected[path]) > 0 {
+				selected[path] = version
+			}
+		}
+		edges = append(edges, edge{fields[0], fields[1]})
+	}
+	indirects := map[string][]string{}
+	for _, e := range edges {
+		from, version := splitModVersion(e.from)
+		if version != selected[from] {
+			continue
+		}
+		to, _ := splitModVersion(e.to)
+		if isMain[to] {
+			continue
+		}
+		if isMain[from] && indirect[to] {
+			indirects[from] = mergeStrings(indirects[from], []string{to})
+			continue
+		}
+		g.requires[from] = mergeStrings(g.requires[from], []string{to})
+	}
+
+	// breadth first walk from every direct dependency, so that depths are minimal
+	var queue []string
+	for _, main := range g.mains {
+		for _, direct := range g.requires[main] {
+			if _, ok := g.depth[direct]; !ok {
+				g.depth[direct] = 1
+				queue = append(queue, direct)
+			}
+			g.introducedBy[direct] = []string{direct}
+		}
+	}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		for _, req := range g.requires[path] {
+			if _, ok := g.depth[req]; !ok {
+				g.depth[req] = g.depth[path] + 1
+				queue = append(queue, req)
+			}
+		}
+	}
+	// modules not required by any other module are attached to the main
+	// modules without being attributed
+	for _, main := range g.mains {
+		for _, path := range indirects[main] {
+			if _, ok := g.depth[path]; !ok {
+				g.requires[main] = append(g.requires[main], path)
+			}
+		}
+	}
+	// propagate the direct dependencies down the graph until nothing changes,
+	// the graph may contain cycles
+	for changed := true; changed; {
+		changed = false
+		for path, reqs := range g.requires {
+			if isMain[path] {
+				continue
+			}
+			for _, req := range reqs {
+				if g.depth[req] == 1 {
+					continue
+				}
+				merged := mergeStrings(g.introducedBy[req], g.introducedBy[path])
+				if len(merged) != len(g.introducedBy[req]) {
+					g.introducedBy[req] = merged
+					changed = true
+				}
+			}
+		}
+	}
+	for _, introducedBy := range g.introducedBy {
+		sort.Strings(introducedBy)
+	}
+	return g
+}
+
+// splitModVersion splits a "path@version" node of 'go mod graph'.
+func splitModVersion(node string) (string, string) {
+	if i := strings.LastIndex(node, "@"); i >= 0 {
+		return node[:i], node[i+1:]
+	}
+	return node, ""
+}
+
+// annotate records on every module the direct dependencies introducing it and
+// its depth in the graph.
+func (g *modGraph) annotate(infos []*PkgInfo) {
+	for _, info := range infos {
+		if depth, ok := g.depth[info.ImportPath]; ok {
+			info.Depth = depth
+			info.IntroducedBy = g.introducedBy[info.ImportPath]
+		}
+	}
+}
+
+// printTree prints the requirements of the main modules as a tree, with the
+// license of every reported module. Modules are expanded once, later
+// occurrences are marked with "(*)". Subtrees without any reported module are
+// omitted.
+func (g *modGraph) printTree(w io.Writer, licenses map[string]string) error {
+	// a module is relevant if it is reported or requires a relevant module
+	requiredBy := map[string][]string{}
+	for path, reqs := range g.requires {
+		for _, req := range reqs {
+			requiredBy[req] = append(requiredBy[req], path)
+		}
+	}
+	relevant := map[string]bool{}
+	var queue []string
+	for path := range licenses {
+		relevant[path] = true
+		queue = append(queue, path)
+	}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		for _, parent := range requiredBy[path] {
+			if !relevant[parent] {
+				relevant[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	printed := map[string]bool{}
+	var printNode func(path, indent string) error
+	printNode = func(path, indent string) error {
+		line := indent + path
+		if license, ok := licenses[path]; ok {
+			line += "  " + license
+		}
+		if printed[path] && len(g.requires[path]) > 0 {
+			_, err := fmt.Fprintln(w, line+" (*)")
+			return err
+		}
+		printed[path] = true
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		reqs := append([]string(nil), g.requires[path]...)
+		sort.Strings(reqs)
+		for _, req := range reqs {
+			if !relevant[req] {
+				continue
+			}
+			if err := printNode(req, indent+"  "); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, main := range g.mains {
+		if err := printNode(main, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
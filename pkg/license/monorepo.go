@@ -0,0 +1,158 @@
+package license
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// findModules returns the directories of the go.mod files under root. vendor
+// and testdata directories are skipped, as well as the ones the go command
+// ignores, starting with "." or "_".
+func findModules(root string) ([]string, error) {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != root && (name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if name == "go.mod" {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find go.mod files under %s", root)
+	}
+	return dirs, nil
+}
+
+// listMonorepoLicenses analyzes the packages of every module under root on its
+// own, ignoring go.work files, and returns the licenses of their dependencies.
+// Dependencies shared by several modules are reported once, with the modules
+// using them, and modules of the tree depending on each other are not
+// reported. Modules which cannot be analyzed are reported with an error
+// diagnostic.
+func listMonorepoLicenses(root string, lo loadOptions) ([]License, error) {
+	if lo.Dir != "" && !filepath.IsAbs(root) {
+		root = filepath.Join(lo.Dir, root)
+	}
+	dirs, err := findModules(root)
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no go.mod file found under %s", root)
+	}
+	lo.NoWorkspace = true
+	firstParty := map[string]bool{}
+	modulePaths := map[string]string{}
+	for _, dir := range dirs {
+		modLo := lo
+		modLo.Dir = dir
+		goMod, err := readGoMod(modLo)
+		if err != nil {
+			return nil, err
+		}
+		if goMod != nil {
+			firstParty[goMod.Module.Path] = true
+			modulePaths[dir] = goMod.Module.Path
+		}
+	}
+	var licenses []License
+	byKey := map[string]int{}
+	for _, dir := range dirs {
+		modLo := lo
+		modLo.Dir = dir
+		patterns, err := defaultPatterns(modLo)
+		var modLicenses []License
+		if err == nil {
+			modLicenses, err = listLicenses(patterns, modLo)
+		}
+		if err != nil {
+			// report the module and keep analyzing the others
+			err = errors.Wrapf(err, "unable to analyze the module in %s", dir)
+			name := modulePaths[dir]
+			if name == "" {
+				name = dir
+			}
+			licenses = append(licenses, License{
+				Package:       name,
+				Err:           err.Error(),
+				UsedByModules: []string{name},
+				Diagnostics:   []Diagnostic{errorDiagnostic(err)},
+			})
+			continue
+		}
+		for _, l := range modLicenses {
+			if isFirstParty(l.Package, firstParty) {
+				continue
+			}
+			key := l.Package + "@" + l.Version
+			if i, ok := byKey[key]; ok {
+				mergeLicense(&licenses[i], l)
+				continue
+			}
+			byKey[key] = len(licenses)
+			licenses = append(licenses, l)
+		}
+	}
+	sort.SliceStable(licenses, func(i, j int) bool {
+		return licenses[i].Package < licenses[j].Package
+	})
+	return licenses, nil
+}
+
+// isFirstParty reports whether pkg belongs to one of the modules.
+func isFirstParty(pkg string, modules map[string]bool) bool {
+	for path := range modules {
+		if pkg == path || strings.HasPrefix(pkg, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryRank orders the categories the way listCategoriesDependencies
+// classifies dependencies, runtime first, and unknown ones last.
+func categoryRank(category string) int {
+	categories := []string{CategoryRuntime, CategoryTool, CategoryTestOnly}
+	for i, c := range categories {
+		if c == category {
+			return i
+		}
+	}
+	return len(categories)
+}
+
+// mergeLicense merges into l the users of the same dependency found in
+// another module.
+func mergeLicense(l *License, other License) {
+	l.UsedBy = mergeStrings(l.UsedBy, other.UsedBy)
+	l.UsedByModules = mergeStrings(l.UsedByModules, other.UsedByModules)
+	l.Targets = mergeStrings(l.Targets, other.Targets)
+	l.Diagnostics = mergeDiagnostics(l.Diagnostics, other.Diagnostics)
+	l.IntroducedBy = mergeStrings(l.IntroducedBy, other.IntroducedBy)
+	l.Native = mergeNative(l.Native, other.Native)
+	l.Embedded = mergeStrings(l.Embedded, other.Embedded)
+	if categoryRank(other.Category) < categoryRank(l.Category) {
+		l.Category = other.Category
+	}
+	if other.Depth > 0 && (l.Depth == 0 || other.Depth < l.Depth) {
+		l.Depth = other.Depth
+	}
+	if len(l.ImportChain) == 0 || (len(other.ImportChain) > 0 && len(other.ImportChain) < len(l.ImportChain)) {
+		l.ImportChain = other.ImportChain
+	}
+}
@@ -0,0 +1,134 @@
+package license
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// NativeCode describes the native code a dependency links or bundles through
+// cgo, which the license of the Go code does not necessarily cover.
+type NativeCode struct {
+	// Libraries lists the libraries linked by #cgo LDFLAGS directives, and the
+	// packages of #cgo pkg-config directives
+	Libraries []string
+	// Sources lists the bundled C, C++ and header files, and prebuilt .syso
+	// objects, as package/file
+	Sources []string
+	// Notices lists the license notices found in the headers of the bundled
+	// sources, as "package/file: notice"
+	Notices []string
+}
+
+// maxReportedFiles is the number of bundled sources, or embedded files,
+// listed in the report, above which they are counted.
+const maxReportedFiles = 5
+
+// maxNoticeLines is the number of lines of a bundled source searched for a
+// license notice.
+const maxNoticeLines = 50
+
+var (
+	reSPDX   = regexp.MustCompile(`SPDX-License-Identifier:\s*([^\s*/]+(?:\s+(?:AND|OR|WITH)\s+[^\s*/]+)*)`)
+	reNotice = regexp.MustCompile(`(?i)\b(copyright|licen[sc]ed?|public domain|disclaims)\b`)
+)
+
+// nativeCode returns the native code of a package using cgo, or bundling
+// prebuilt objects, nil otherwise.
+func nativeCode(pkg *goListPackage) *NativeCode {
+	if len(pkg.CgoFiles) == 0 && len(pkg.SysoFiles) == 0 {
+		return nil
+	}
+	pkgPath := strings.SplitN(pkg.ImportPath, " ", 2)[0]
+	native := &NativeCode{}
+	for i := 0; i < len(pkg.CgoLDFLAGS); i++ {
+		flag := pkg.CgoLDFLAGS[i]
+		switch {
+		case flag == "-l" && i+1 < len(pkg.CgoLDFLAGS):
+			i++
+			native.Libraries = mergeStrings(native.Libraries, []string{pkg.CgoLDFLAGS[i]})
+		case strings.HasPrefix(flag, "-l"):
+			native.Libraries = mergeStrings(native.Libraries, []string{strings.TrimPrefix(flag, "-l")})
+		case !strings.HasPrefix(flag, "-") && (strings.HasSuffix(flag, ".a") ||
+			strings.HasSuffix(flag, ".so") || strings.Contains(flag, ".so.")):
+			native.Libraries = mergeStrings(native.Libraries, []string{filepath.Base(flag)})
+		}
+	}
+	for _, name := range pkg.CgoPkgConfig {
+		if !strings.HasPrefix(name, "-") {
+			native.Libraries = mergeStrings(native.Libraries, []string{"pkg-config:" + name})
+		}
+	}
+	var files []string
+	files = append(files, pkg.CFiles...)
+	files = append(files, pkg.CXXFiles...)
+	files = append(files, pkg.HFiles...)
+	for _, file := range files {
+		native.Sources = append(native.Sources, pkgPath+"/"+file)
+		if notice := sourceNotice(filepath.Join(pkg.Dir, file)); notice != "" {
+			native.Notices = append(native.Notices, pkgPath+"/"+file+": "+notice)
+		}
+	}
+	for _, file := range pkg.SysoFiles {
+		native.Sources = append(native.Sources, pkgPath+"/"+file)
+	}
+	return native
+}
+
+// sourceNotice returns the license notice in the header of a C or C++ source
+// file: its SPDX license identifier if any, else the first line mentioning a
+// copyright or license. It returns an empty string if none was found.
+func sourceNotice(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	notice := ""
+	scanner := bufio.NewScanner(f)
+	for n := 0; n < maxNoticeLines && scanner.Scan(); n++ {
+		line := scanner.Text()
+		if m := reSPDX.FindStringSubmatch(line); m != nil {
+			return "SPDX-License-Identifier: " + m[1]
+		}
+		if notice == "" && reNotice.MatchString(line) {
+			notice = strings.TrimSpace(strings.Trim(strings.TrimSpace(line), "/*#"))
+		}
+	}
+	return notice
+}
+
+// mergeNative returns the native code of a and b, nil if both are nil.
+func mergeNative(a, b *NativeCode) *NativeCode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &NativeCode{
+		Libraries: mergeStrings(a.Libraries, b.Libraries),
+		Sources:   mergeStrings(a.Sources, b.Sources),
+		Notices:   mergeStrings(a.Notices, b.Notices),
+	}
+}
+
+// nativeDiagnostic returns the warning flagging a dependency with native
+// code, to be reviewed separately.
+func nativeDiagnostic(native *NativeCode) Diagnostic {
+	var parts []string
+	if len(native.Libraries) > 0 {
+		parts = append(parts, "links "+strings.Join(native.Libraries, ", "))
+	}
+	if len(native.Sources) > 0 {
+		parts = append(parts, fmt.Sprintf("bundles %d C/C++ or object files", len(native.Sources)))
+	}
+	message := "uses native code"
+	if len(parts) > 0 {
+		message += ": " + strings.Join(parts, ", ")
+	}
+	return Diagnostic{Severity: SeverityWarning, Message: message}
+}
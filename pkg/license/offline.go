@@ -0,0 +1,60 @@
+package license
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// modFilesSnapshot records the content of the go.mod, go.sum, go.work and
+// go.work.sum files in use, nil for the ones which do not exist.
+type modFilesSnapshot map[string][]byte
+
+// snapshotModFiles records the module files the go command may update.
+func snapshotModFiles(lo loadOptions) (modFilesSnapshot, error) {
+	snapshot := modFilesSnapshot{}
+	if lo.Gopath != "" {
+		return snapshot, nil
+	}
+	paths, err := lo.goEnv("GOMOD", "GOWORK")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to locate module files")
+	}
+	for _, path := range paths {
+		if path == "" || path == "off" || path == os.DevNull {
+			continue
+		}
+		sumPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".sum"
+		if filepath.Base(path) == "go.work" {
+			sumPath = path + ".sum"
+		}
+		for _, p := range []string{path, sumPath} {
+			data, err := ioutil.ReadFile(p)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, errors.Wrapf(err, "unable to read %s", p)
+			}
+			snapshot[p] = data
+		}
+	}
+	return snapshot, nil
+}
+
+// verify returns an error if any of the recorded files changed since the
+// snapshot was taken.
+func (s modFilesSnapshot) verify() error {
+	for path, before := range s {
+		after, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "unable to read %s", path)
+		}
+		if (before == nil) != (after == nil) || !bytes.Equal(before, after) {
+			return fmt.Errorf("%s was modified while listing dependencies offline", path)
+		}
+	}
+	return nil
+}
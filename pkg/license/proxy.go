@@ -0,0 +1,177 @@
+package license
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+)
+
+// moduleFetcher downloads the zips of modules missing from the module cache.
+type moduleFetcher interface {
+	// fetchZip returns the zip of module path@version and its URL.
+	fetchZip(path, version string) ([]byte, string, error)
+}
+
+const (
+	// proxyTimeout bounds every request to a module proxy, so that a stalled
+	// proxy does not hang the run
+	proxyTimeout = 2 * time.Minute
+	// maxZipSize is the size of the largest module zip read from a proxy, the
+	// limit of the go command
+	maxZipSize = 500 << 20
+)
+
+// proxyFetcher downloads module zips with the GOPROXY protocol from the
+// proxies of the go environment, skipping the modules matching GONOPROXY.
+type proxyFetcher struct {
+	lo     loadOptions
+	client *http.Client
+	// maxSize is the size of the largest zip read
+	maxSize int64
+	// proxies and noProxy are looked up on first use
+	proxies []string
+	noProxy []string
+	loaded  bool
+}
+
+func newProxyFetcher(lo loadOptions) *proxyFetcher {
+	// offline runs disable GOPROXY for the go command only
+	lo.Offline = false
+	transport := &http.Transport{}
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return &proxyFetcher{
+		lo:      lo,
+		client:  &http.Client{Transport: transport, Timeout: proxyTimeout},
+		maxSize: maxZipSize,
+	}
+}
+
+func (f *proxyFetcher) load() error {
+	if f.loaded {
+		return nil
+	}
+	values, err := f.lo.goEnv("GOPROXY", "GONOPROXY")
+	if err != nil {
+		return errors.Wrap(err, "unable to locate the module proxies")
+	}
+	for _, proxy := range strings.FieldsFunc(values[0], func(r rune) bool { return r == ',' || r == '|' }) {
+		if proxy == "off" {
+			break
+		}
+		if proxy != "direct" {
+			f.proxies = append(f.proxies, strings.TrimSuffix(proxy, "/"))
+		}
+	}
+	f.noProxy = strings.Split(values[1], ",")
+	f.loaded = true
+	return nil
+}
+
+func (f *proxyFetcher) fetchZip(modPath, version string) ([]byte, string, error) {
+	if err := f.load(); err != nil {
+		return nil, "", err
+	}
+	if matchPathPrefix(f.noProxy, modPath) {
+		return nil, "", fmt.Errorf("%s matches GONOPROXY", modPath)
+	}
+	if len(f.proxies) == 0 {
+		return nil, "", fmt.Errorf("no module proxy to download %s@%s from", modPath, version)
+	}
+	escapedPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return nil, "", err
+	}
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, "", err
+	}
+	var errs []string
+	for _, proxy := range f.proxies {
+		url := proxy + "/" + escapedPath + "/@v/" + escapedVersion + ".zip"
+		data, err := f.get(url)
+		if err == nil {
+			return data, url, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, "", fmt.Errorf("unable to download %s@%s: %s", modPath, version, strings.Join(errs, "; "))
+}
+
+func (f *proxyFetcher) get(url string) ([]byte, error) {
+	resp, err := f.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.maxSize {
+		return nil, fmt.Errorf("%s: larger than %d bytes", url, f.maxSize)
+	}
+	return data, nil
+}
+
+// matchPathPrefix reports whether a leading part of modPath matches one of
+// the glob patterns, as GOPRIVATE and GONOPROXY do.
+func matchPathPrefix(patterns []string, modPath string) bool {
+	elems := strings.Split(modPath, "/")
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		n := strings.Count(pattern, "/") + 1
+		if n > len(elems) {
+			continue
+		}
+		if ok, _ := path.Match(pattern, strings.Join(elems[:n], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchLicense looks for the license of a module missing from the module
+// cache, or without a license file there, in its zip downloaded from the
+// module proxy. It returns whether the zip was downloaded.
+func (lm *licenseMatcher) fetchLicense(info *PkgInfo, license *License) (bool, error) {
+	modPath, version, ok := zipModule(info)
+	if lm.fetcher == nil || !ok {
+		return false, nil
+	}
+	data, url, err := lm.fetcher.fetchZip(modPath, version)
+	if err != nil {
+		return false, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to read the zip of %s@%s", modPath, version)
+	}
+	if err := lm.matchZipLicense(zr, modPath, version, url, license); err != nil {
+		return false, err
+	}
+	if err := lm.verifyModule(info, modPath, version, license, func() (string, error) { return hashZip(zr) }); err != nil {
+		return false, err
+	}
+	if license.Path != "" {
+		license.Diagnostics = append(license.Diagnostics, Diagnostic{
+			Severity: SeverityInfo,
+			Message:  "license downloaded from " + url,
+		})
+	}
+	return true, nil
+}
@@ -0,0 +1,57 @@
+package license
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StdPackage is the package of the entry of the Go standard library.
+const StdPackage = "std"
+
+// stdLicense returns the entry of the Go runtime and standard library, linked
+// into every Go binary with the golang.org/x packages vendored in GOROOT. Its
+// version is the supplied one, such as the one binaries were built with, else
+// the one of the go command, and its text the one of $GOROOT/LICENSE followed
+// by $GOROOT/PATENTS.
+func stdLicense(lo loadOptions, version string) (License, error) {
+	values, err := lo.goEnv("GOROOT", "GOVERSION")
+	if err != nil {
+		return License{}, errors.Wrap(err, "unable to locate GOROOT")
+	}
+	goroot := values[0]
+	if version == "" {
+		version = values[1]
+	}
+	lm, err := newLicenseMatcher(lo)
+	if err != nil {
+		return License{}, err
+	}
+	path := filepath.Join(goroot, "LICENSE")
+	m, err := lm.match(path)
+	if err != nil {
+		return License{}, errors.Wrap(err, "unable to read the license of the Go standard library")
+	}
+	content := append([]byte{}, m.FileContent...)
+	if patents, err := ioutil.ReadFile(filepath.Join(goroot, "PATENTS")); err == nil {
+		content = append(append(content, "\n\n"...), patents...)
+	}
+	license := License{
+		Package:      StdPackage,
+		Version:      version,
+		Score:        m.Score,
+		Template:     m.Template,
+		Path:         path,
+		ExtraWords:   m.ExtraWords,
+		MissingWords: m.MissingWords,
+		FileContent:  content,
+		Category:     CategoryRuntime,
+	}
+	// releases are tagged in the Go repository, unlike development versions
+	if strings.HasPrefix(version, "go") && !strings.Contains(version, " ") {
+		license.ManualPath = "https://go.googlesource.com/go/+/refs/tags/" + version + "/LICENSE"
+	}
+	return license, nil
+}
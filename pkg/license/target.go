@@ -0,0 +1,72 @@
+package license
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Target is a platform and set of build tags the analyzed packages are built for.
+// The zero value stands for the platform of the go command, without extra tags.
+type Target struct {
+	GOOS   string
+	GOARCH string
+	Tags   []string
+}
+
+// ParseTarget parses targets of the form "goos/goarch", optionally followed by
+// build tags separated with "+", ex: "linux/amd64+enterprise".
+func ParseTarget(s string) (Target, error) {
+	parts := strings.Split(s, "+")
+	platform := strings.Split(parts[0], "/")
+	if len(platform) != 2 || platform[0] == "" || platform[1] == "" {
+		return Target{}, fmt.Errorf("invalid target %q, expected goos/goarch[+tag...]", s)
+	}
+	target := Target{
+		GOOS:   platform[0],
+		GOARCH: platform[1],
+	}
+	for _, tag := range parts[1:] {
+		if tag == "" {
+			return Target{}, fmt.Errorf("invalid target %q, empty build tag", s)
+		}
+		target.Tags = append(target.Tags, tag)
+	}
+	return target, nil
+}
+
+// ParseTargets parses each of the supplied targets with ParseTarget.
+func ParseTargets(specs []string) ([]Target, error) {
+	var targets []Target
+	for _, spec := range specs {
+		target, err := ParseTarget(spec)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func (t Target) String() string {
+	if t.GOOS == "" && t.GOARCH == "" {
+		return "host"
+	}
+	return strings.Join(append([]string{t.GOOS + "/" + t.GOARCH}, t.Tags...), "+")
+}
+
+// env returns base, or the process environment if base is nil, with GOOS and
+// GOARCH set for the target.
+func (t Target) env(base []string) []string {
+	if t.GOOS == "" && t.GOARCH == "" {
+		return base
+	}
+	return setEnv(base, "GOOS="+t.GOOS, "GOARCH="+t.GOARCH)
+}
+
+// buildFlags returns the go command flags selecting the target build tags.
+func (t Target) buildFlags() []string {
+	if len(t.Tags) == 0 {
+		return nil
+	}
+	return []string{"-tags", strings.Join(t.Tags, ",")}
+}
@@ -0,0 +1,11 @@
+package a
+
+import (
+	"testing"
+
+	"example.com/shared"
+)
+
+func TestA(t *testing.T) {
+	shared.Hello()
+}
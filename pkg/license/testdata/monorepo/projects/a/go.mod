@@ -0,0 +1,7 @@
+module example.com/a
+
+go 1.18
+
+require example.com/shared v0.0.0
+
+replace example.com/shared => ../../../workspace/shared
@@ -0,0 +1,5 @@
+package brown
+
+func Brown() string {
+	return "brown"
+}
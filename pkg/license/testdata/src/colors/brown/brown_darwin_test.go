@@ -0,0 +1,3 @@
+package brown
+
+import _ "colors/red"
@@ -0,0 +1,13 @@
+package green
+
+import (
+	"testing"
+
+	_ "colors/blue"
+)
+
+func TestGreen(t *testing.T) {
+	if green() != "green" {
+		t.Fatal("not green")
+	}
+}
@@ -0,0 +1,10 @@
+/*
+** 2001 September 15
+**
+** The author disclaims copyright to this source code.
+*/
+#include "mix.h"
+
+int mix(int a, int b) {
+	return a + b;
+}
@@ -0,0 +1,2 @@
+// SPDX-License-Identifier: MIT
+int mix(int a, int b);
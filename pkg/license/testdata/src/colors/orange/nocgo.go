@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package orange
+
+import _ "colors/red"
+
+func Orange() int {
+	return 3
+}
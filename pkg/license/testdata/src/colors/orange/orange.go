@@ -0,0 +1,10 @@
+package orange
+
+// #cgo LDFLAGS: -lm -l pigment
+// #cgo pkg-config: cairo
+// #include "mix.h"
+import "C"
+
+func Orange() int {
+	return int(C.mix(1, 2))
+}
@@ -0,0 +1,6 @@
+package white
+
+import "embed"
+
+//go:embed fonts static/index.html
+var Assets embed.FS
@@ -0,0 +1,17 @@
+module example.com/app
+
+go 1.24
+
+tool example.com/linter/cmd/lint
+
+require (
+	example.com/gen v0.0.0
+	example.com/lib v0.0.0
+	example.com/linter v0.0.0
+)
+
+replace (
+	example.com/gen => ./deps/gen
+	example.com/lib => ./deps/lib
+	example.com/linter => ./deps/linter
+)
@@ -0,0 +1,10 @@
+module example.com/vendored
+
+go 1.13
+
+require (
+	example.com/red v0.1.0
+	example.com/unused v1.0.0
+)
+
+replace example.com/red => example.com/fork/red v0.1.1
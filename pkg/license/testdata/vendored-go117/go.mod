@@ -0,0 +1,12 @@
+module example.com/vendored
+
+go 1.17
+
+require (
+	example.com/red v0.1.0
+	example.com/unused v1.0.0
+)
+
+require example.com/blue v1.2.0 // indirect
+
+replace example.com/red => example.com/fork/red v0.1.1
@@ -0,0 +1,11 @@
+module example.com/vendored
+
+go 1.14
+
+require (
+	example.com/blue v1.2.0 // indirect
+	example.com/red v0.1.0
+	example.com/unused v1.0.0
+)
+
+replace example.com/red => example.com/fork/red v0.1.1
@@ -0,0 +1,7 @@
+package main
+
+import "example.com/shared"
+
+func main() {
+	shared.Hello()
+}
@@ -0,0 +1,148 @@
+package license
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// vendoredModule is a module entry of vendor/modules.txt.
+type vendoredModule struct {
+	Path     string
+	Version  string
+	Packages []string
+	// ReplacePath and ReplaceVersion identify the module replacing this one,
+	// whose content is vendored under Path
+	ReplacePath    string
+	ReplaceVersion string
+}
+
+// listVendorLicenses returns the licenses of the modules vendored in the
+// vendor directory of the module rooted at dir.
+func listVendorLicenses(dir string, lo loadOptions) ([]License, error) {
+	infos, err := listVendorDependencies(dir, lo.IncludeIndirectDeps)
+	if err != nil {
+		return nil, err
+	}
+	return matchLicenses(infos, lo)
+}
+
+// listVendorDependencies returns one entry per module with packages vendored
+// in the vendor directory of the module rooted at dir, as listed by
+// vendor/modules.txt. Neither the go command nor the module cache is used.
+// includeIndirectDeps determines whether modules not required directly by the
+// go.mod file are listed: "## explicit" annotations of modules.txt do not
+// tell, as they mark indirect requirements too since go 1.17, and are missing
+// before go 1.14.
+func listVendorDependencies(dir string, includeIndirectDeps bool) ([]*PkgInfo, error) {
+	vendorDir := filepath.Join(dir, "vendor")
+	modules, err := parseVendorModules(filepath.Join(vendorDir, "modules.txt"))
+	if err != nil {
+		return nil, err
+	}
+	direct, err := parseDirectRequirements(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	var depInfos []*PkgInfo
+	for _, mod := range modules {
+		// modules without vendored packages are required but not built
+		if len(mod.Packages) == 0 || (!direct[mod.Path] && !includeIndirectDeps) {
+			continue
+		}
+		modDir := filepath.Join(vendorDir, filepath.FromSlash(mod.Path))
+		var pkgs []ModulePackage
+		for _, pkg := range mod.Packages {
+			pkgs = append(pkgs, ModulePackage{
+				ImportPath: pkg,
+				Dir:        filepath.Join(vendorDir, filepath.FromSlash(pkg)),
+			})
+		}
+		depInfos = append(depInfos, &PkgInfo{
+			Packages:       pkgs,
+			Name:           mod.Path,
+			Dir:            modDir,
+			Root:           modDir,
+			ImportPath:     mod.Path,
+			Version:        mod.Version,
+			ReplacePath:    mod.ReplacePath,
+			ReplaceVersion: mod.ReplaceVersion,
+		})
+	}
+	sort.Slice(depInfos, func(i, j int) bool {
+		return depInfos[i].ImportPath < depInfos[j].ImportPath
+	})
+	return depInfos, nil
+}
+
+// parseVendorModules parses a vendor/modules.txt file.
+func parseVendorModules(path string) ([]*vendoredModule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read vendored modules")
+	}
+	defer f.Close()
+	var modules []*vendoredModule
+	var current *vendoredModule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "## "):
+			// annotations
+			continue
+		case strings.HasPrefix(line, "# "):
+			// # path version [=> replacement [version]]
+			fields := strings.Fields(line[len("# "):])
+			current = &vendoredModule{
+				Path: fields[0],
+			}
+			if len(fields) > 1 && fields[1] != "=>" {
+				current.Version = fields[1]
+			}
+			for i, field := range fields {
+				if field == "=>" && len(fields) > i+1 {
+					current.ReplacePath = fields[i+1]
+					if len(fields) > i+2 {
+						current.ReplaceVersion = fields[i+2]
+					}
+				}
+			}
+			modules = append(modules, current)
+		default:
+			if current != nil {
+				current.Packages = append(current.Packages, line)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "unable to read vendored modules")
+	}
+	return modules, nil
+}
+
+// parseDirectRequirements returns the modules required by a go.mod file
+// without an "// indirect" comment. Directives unknown to x/mod are ignored.
+func parseDirectRequirements(path string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read the requirements of the vendored modules")
+	}
+	f, err := modfile.ParseLax(path, data, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read the requirements of the vendored modules")
+	}
+	direct := map[string]bool{}
+	for _, r := range f.Require {
+		direct[r.Mod.Path] = direct[r.Mod.Path] || !r.Indirect
+	}
+	return direct, nil
+}
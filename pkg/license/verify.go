@@ -0,0 +1,151 @@
+package license
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// hashZip returns the "h1:" hash of go.sum over the files of a module zip.
+func hashZip(zr *zip.Reader) (string, error) {
+	files := map[string]*zip.File{}
+	var names []string
+	for _, f := range zr.File {
+		if _, ok := files[f.Name]; ok {
+			return "", fmt.Errorf("duplicate file %s in zip", f.Name)
+		}
+		files[f.Name] = f
+		names = append(names, f.Name)
+	}
+	return dirhash.Hash1(names, func(name string) (io.ReadCloser, error) {
+		return files[name].Open()
+	})
+}
+
+// readGoSums returns the module hashes of the go.sum files of the main module,
+// or of the modules of the go.work workspace and its go.work.sum file, by
+// "path version".
+func readGoSums(lo loadOptions) (map[string]string, error) {
+	var files []string
+	gowork, err := goWorkFile(lo)
+	if err != nil {
+		return nil, err
+	}
+	if gowork != "" {
+		files = append(files, filepath.Join(filepath.Dir(gowork), "go.work.sum"))
+		modules, err := listWorkspaceModules(lo)
+		if err != nil {
+			return nil, err
+		}
+		for _, mod := range modules {
+			files = append(files, filepath.Join(mod.Dir, "go.sum"))
+		}
+	} else {
+		values, err := lo.goEnv("GOMOD")
+		if err != nil {
+			return nil, err
+		}
+		if values[0] != "" && values[0] != os.DevNull {
+			files = append(files, filepath.Join(filepath.Dir(values[0]), "go.sum"))
+		}
+	}
+	sums := map[string]string{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read go.sum")
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+				continue
+			}
+			sums[fields[0]+" "+fields[1]] = fields[2]
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read %s", file)
+		}
+	}
+	return sums, nil
+}
+
+// verifyModule compares the hash of the files of module path@version, the one
+// the license of a module was read from, with go.sum, or for modules of binaries
+// with the hash recorded in their build information. It records an error
+// diagnostic if they differ, or a warning if there is no hash to compare with.
+func (lm *licenseMatcher) verifyModule(info *PkgInfo, modPath, version string, license *License,
+	hash func() (string, error)) error {
+	if !lm.lo.Verify || lm.lo.Gopath != "" {
+		return nil
+	}
+	source := "go.sum"
+	var expected string
+	var ok bool
+	if info.Sum != "" {
+		// the go.sum of the working directory is unrelated to the binaries
+		source = "the build info"
+		if infoPath, infoVersion, _ := zipModule(info); infoPath == modPath && infoVersion == version {
+			expected, ok = info.Sum, true
+		}
+	} else {
+		if lm.goSums == nil {
+			sums, err := readGoSums(lm.lo)
+			if err != nil {
+				return err
+			}
+			lm.goSums = sums
+		}
+		expected, ok = lm.goSums[modPath+" "+version]
+	}
+	if !ok {
+		license.Diagnostics = append(license.Diagnostics, Diagnostic{
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("no hash in %s to verify %s@%s against", source, modPath, version),
+		})
+		return nil
+	}
+	got, err := hash()
+	if err != nil {
+		return err
+	}
+	if got != expected {
+		license.Diagnostics = append(license.Diagnostics, Diagnostic{
+			Severity: SeverityError,
+			Message: fmt.Sprintf("%s@%s does not match %s, its files may have been modified: %s != %s",
+				modPath, version, source, got, expected),
+		})
+	}
+	return nil
+}
+
+// verifyModuleDir verifies the directory of module path@version in the module
+// cache, see verifyModule. Other directories, such as vendored modules, are not
+// verified.
+func (lm *licenseMatcher) verifyModuleDir(info *PkgInfo, modPath, version, dir string, license *License) error {
+	if !lm.lo.Verify || dir == "" || version == "" || lm.lo.Gopath != "" {
+		return nil
+	}
+	modCache, err := lm.moduleCache()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(dir, modCache+string(filepath.Separator)) {
+		return nil
+	}
+	return lm.verifyModule(info, modPath, version, license, func() (string, error) {
+		return dirhash.HashDir(dir, modPath+"@"+version, dirhash.Hash1)
+	})
+}
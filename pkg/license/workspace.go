@@ -0,0 +1,58 @@
+package license
+
+import "github.com/pkg/errors"
+
+// goWorkFile returns the path of the go.work file in use, an empty string
+// outside of a workspace or in GOPATH mode.
+func goWorkFile(lo loadOptions) (string, error) {
+	if lo.Gopath != "" {
+		return "", nil
+	}
+	values, err := lo.goEnv("GOWORK")
+	if err != nil {
+		return "", errors.Wrap(err, "unable to locate go.work")
+	}
+	gowork := values[0]
+	if gowork == "off" {
+		return "", nil
+	}
+	return gowork, nil
+}
+
+// listWorkspaceModules returns the modules used by the go.work workspace,
+// which are all treated as first-party.
+func listWorkspaceModules(lo loadOptions) ([]*goListModule, error) {
+	listed, err := lo.listModules()
+	if err != nil {
+		return nil, err
+	}
+	var modules []*goListModule
+	for _, mod := range listed {
+		if mod.Main {
+			modules = append(modules, mod)
+		}
+	}
+	return modules, nil
+}
+
+// defaultPatterns returns the package patterns matching every first-party
+// package: "./..." for a single module, and the packages of each of its
+// modules for a go.work workspace.
+func defaultPatterns(lo loadOptions) ([]string, error) {
+	gowork, err := goWorkFile(lo)
+	if err != nil {
+		return nil, err
+	}
+	if gowork == "" {
+		return []string{"./..."}, nil
+	}
+	modules, err := listWorkspaceModules(lo)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, mod := range modules {
+		patterns = append(patterns, mod.Path+"/...")
+	}
+	return patterns, nil
+}
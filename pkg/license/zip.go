@@ -0,0 +1,114 @@
+package license
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// zipModule returns the module@version whose zip holds the files of a module,
+// its replacement if any, false for modules without a zip, such as the ones
+// replaced by a directory.
+func zipModule(info *PkgInfo) (string, string, bool) {
+	if info.ReplacePath != "" {
+		return info.ReplacePath, info.ReplaceVersion, info.ReplaceVersion != ""
+	}
+	return info.ImportPath, info.Version, info.Version != ""
+}
+
+// moduleCacheZip returns the path of the zip of module path@version downloaded
+// in the module cache rooted at modCache.
+func moduleCacheZip(modCache, path, version string) (string, error) {
+	escapedPath, err := module.EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(modCache, "cache", "download",
+		filepath.FromSlash(escapedPath), "@v", escapedVersion+".zip"), nil
+}
+
+// cacheZipLicense looks for the license of a module whose directory is missing
+// from the module cache, such as when extracted directories are pruned, in its
+// zip kept in the module cache. It returns whether the zip was found.
+func (lm *licenseMatcher) cacheZipLicense(info *PkgInfo, license *License) (bool, error) {
+	modPath, version, ok := zipModule(info)
+	if !ok || lm.lo.Gopath != "" {
+		return false, nil
+	}
+	modCache, err := lm.moduleCache()
+	if err != nil {
+		return false, err
+	}
+	path, err := moduleCacheZip(modCache, modPath, version)
+	if err != nil {
+		return false, err
+	}
+	zr, err := zip.OpenReader(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to read the zip of %s@%s", modPath, version)
+	}
+	defer zr.Close()
+	if err := lm.matchZipLicense(&zr.Reader, modPath, version, path, license); err != nil {
+		return true, err
+	}
+	return true, lm.verifyModule(info, modPath, version, license, func() (string, error) {
+		return dirhash.HashZip(path, dirhash.Hash1)
+	})
+}
+
+// matchZipLicense matches the file at the root of the zip of module
+// path@version most likely to be a license file, extracting only this file.
+// location is the path or URL of the zip, the license path being
+// location#name.
+func (lm *licenseMatcher) matchZipLicense(zr *zip.Reader, modPath, version, location string, license *License) error {
+	prefix := modPath + "@" + version + "/"
+	var best *zip.File
+	bestScore := float64(0)
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, prefix)
+		if name == f.Name || strings.Contains(name, "/") || !f.Mode().IsRegular() {
+			continue
+		}
+		if score := scoreLicenseName(name); score > bestScore {
+			best, bestScore = f, score
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	path := location + "#" + strings.TrimPrefix(best.Name, prefix)
+	m, ok := lm.matched[path]
+	if !ok {
+		rc, err := best.Open()
+		if err != nil {
+			return errors.Wrapf(err, "unable to read the zip of %s@%s", modPath, version)
+		}
+		defer rc.Close()
+		content, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read the zip of %s@%s", modPath, version)
+		}
+		m = matchTemplates(content, lm.templates)
+		lm.matched[path] = m
+	}
+	license.Path = path
+	license.Score = m.Score
+	license.Template = m.Template
+	license.ExtraWords = m.ExtraWords
+	license.MissingWords = m.MissingWords
+	license.FileContent = m.FileContent
+	return nil
+}